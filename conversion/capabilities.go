@@ -0,0 +1,57 @@
+package conversion
+
+import (
+	"fmt"
+
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+	"github.com/jiaobendaye/go-claude-code-proxy/models"
+)
+
+// CapabilityError reports a request needing something the upstream model can't do, according to
+// its profile. It is reported as an invalid_request_error, after trying the route's fallbacks.
+type CapabilityError struct {
+	Model   string
+	Feature string
+}
+
+func (e *CapabilityError) Error() string {
+	return fmt.Sprintf("model %s does not support %s", e.Model, e.Feature)
+}
+
+// CheckCapabilities rejects requests the upstream model of the route can't serve. Tool definitions
+// alone are no reason, they are dropped for models without tools; a conversation that already
+// used tools or a tool_choice forcing one is.
+func CheckCapabilities(claudeRequest *models.ClaudeMessagesRequest, route core.Route) error {
+	profile := core.GetModelManager().ModelProfile(route.Provider, route.Model)
+	// Images of tool results the model doesn't get are left as a note
+	images := imageSources(claudeRequest.Messages, profile.ToolResultImageMode() == core.TOOL_RESULT_IMAGES_MESSAGE)
+	// Models without vision may get the images as text instead
+	fallback := profile.ImageFallbackMode(core.GetConfig())
+	if fallback == core.IMAGE_FALLBACK_REJECT && len(images) > 0 {
+		return &CapabilityError{Model: route.Model, Feature: "image input"}
+	}
+	if route.Provider == nil || route.Provider.Type != core.PROVIDER_ANTHROPIC {
+		// File ids refer to the Anthropic Files API, no other upstream can resolve them
+		for _, source := range images {
+			if source.Type == core.SOURCE_FILE && fallback == "" {
+				return &CapabilityError{Model: route.Model, Feature: "images from the Files API"}
+			}
+		}
+		for _, source := range documentSources(claudeRequest.Messages) {
+			if source.Type == core.SOURCE_FILE {
+				return &CapabilityError{Model: route.Model, Feature: "documents from the Files API"}
+			}
+		}
+	}
+	if !core.Supports(profile.Tools) {
+		if choice, _ := claudeRequest.ToolChoice["type"].(string); len(claudeRequest.Tools) > 0 && (choice == "any" || choice == "tool") {
+			return &CapabilityError{Model: route.Model, Feature: "tool use"}
+		}
+		for _, msg := range claudeRequest.Messages {
+			if core.HasBlockType(msg.Content, core.CONTENT_TOOL_USE) || core.HasBlockType(msg.Content, core.CONTENT_TOOL_RESULT) {
+				return &CapabilityError{Model: route.Model, Feature: "tool use"}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package conversion
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+	"github.com/jiaobendaye/go-claude-code-proxy/models"
+	"github.com/sashabaranov/go-openai"
+)
+
+// claudeMinThinkingBudget is the smallest thinking budget Claude accepts.
+const claudeMinThinkingBudget = 1024
+
+// ConvertOpenaiToClaude converts a chat completion request of an OpenAI client to a Claude
+// request, so it can go through the same routing and backends as Claude requests.
+func ConvertOpenaiToClaude(openaiRequest *models.OpenAIChatRequest) (*models.ClaudeMessagesRequest, error) {
+	if openaiRequest.N > 1 {
+		return nil, fmt.Errorf("n greater than 1 is not supported")
+	}
+
+	claudeRequest := &models.ClaudeMessagesRequest{
+		Model:         openaiRequest.Model,
+		MaxTokens:     openaiRequest.MaxCompletionTokens,
+		StopSequences: openaiRequest.Stop,
+		Stream:        openaiRequest.Stream,
+		Temperature:   openaiRequest.Temperature,
+		TopP:          openaiRequest.TopP,
+	}
+	if claudeRequest.MaxTokens == 0 {
+		claudeRequest.MaxTokens = openaiRequest.MaxTokens
+	}
+	if claudeRequest.MaxTokens == 0 {
+		// max_tokens is optional for OpenAI clients, but required by Claude
+		claudeRequest.MaxTokens = core.GetConfig().MaxTokensLimit
+	}
+	if openaiRequest.User != "" {
+		claudeRequest.Metadata = map[string]any{"user_id": openaiRequest.User}
+	}
+
+	for i, msg := range openaiRequest.Messages {
+		switch msg.Role {
+		case openai.ChatMessageRoleSystem, openai.ChatMessageRoleDeveloper:
+			// Claude has a single system prompt, system messages anywhere add to it
+			claudeRequest.System = append(claudeRequest.System, convertOpenaiContent(msg)...)
+		case openai.ChatMessageRoleUser:
+			claudeRequest.Messages = appendClaudeMessage(claudeRequest.Messages, core.ROLE_USER, convertOpenaiContent(msg))
+		case openai.ChatMessageRoleAssistant:
+			claudeRequest.Messages = appendClaudeMessage(claudeRequest.Messages, core.ROLE_ASSISTANT, convertOpenaiAssistantContent(msg))
+		case openai.ChatMessageRoleTool:
+			toolResult := models.ClaudeContentBlockToolResult{
+				Type:      core.CONTENT_TOOL_RESULT,
+				ToolUseID: msg.ToolCallID,
+				Content:   convertOpenaiContent(msg),
+			}
+			claudeRequest.Messages = appendClaudeMessage(claudeRequest.Messages, core.ROLE_USER, models.ClaudeContent{toolResult})
+		default:
+			return nil, fmt.Errorf("messages[%d]: unsupported role %q", i, msg.Role)
+		}
+	}
+
+	for _, tool := range openaiRequest.Tools {
+		if tool.Function == nil || tool.Function.Name == "" {
+			continue
+		}
+		inputSchema, _ := tool.Function.Parameters.(map[string]any)
+		if inputSchema == nil {
+			inputSchema = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+		claudeRequest.Tools = append(claudeRequest.Tools, models.ClaudeTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: inputSchema,
+		})
+	}
+	claudeRequest.ToolChoice = convertOpenaiToolChoice(openaiRequest.ToolChoice)
+	if parallel, ok := openaiRequest.ParallelToolCalls.(bool); ok && !parallel && len(claudeRequest.Tools) > 0 {
+		if claudeRequest.ToolChoice == nil {
+			claudeRequest.ToolChoice = map[string]any{"type": "auto"}
+		}
+		claudeRequest.ToolChoice["disable_parallel_tool_use"] = true
+	}
+
+	// Claude needs room for the answer after the thinking budget
+	budget := core.ReasoningBudgetForEffort(openaiRequest.ReasoningEffort)
+	if budget >= claudeRequest.MaxTokens {
+		budget = claudeRequest.MaxTokens / 2
+	}
+	if budget >= claudeMinThinkingBudget {
+		claudeRequest.Thinking = models.ClaudeThinkingConfig{Type: "enabled", BudgetTokens: budget}
+	}
+
+	return claudeRequest, nil
+}
+
+// appendClaudeMessage adds content to the conversation, merging it into the last message when
+// that has the same role, since Claude expects the roles to alternate.
+func appendClaudeMessage(messages []models.ClaudeMessage, role string, content models.ClaudeContent) []models.ClaudeMessage {
+	if len(content) == 0 {
+		return messages
+	}
+	if last := len(messages) - 1; last >= 0 && messages[last].Role == role {
+		messages[last].Content = append(messages[last].Content, content...)
+		return messages
+	}
+	return append(messages, models.ClaudeMessage{Role: role, Content: content})
+}
+
+// convertOpenaiContent converts the text and image parts of a message to Claude blocks.
+func convertOpenaiContent(msg openai.ChatCompletionMessage) models.ClaudeContent {
+	if len(msg.MultiContent) == 0 {
+		if msg.Content == "" {
+			return nil
+		}
+		return models.ClaudeContent{models.ClaudeContentBlockText{Type: core.CONTENT_TEXT, Text: msg.Content}}
+	}
+
+	content := models.ClaudeContent{}
+	for _, part := range msg.MultiContent {
+		switch part.Type {
+		case openai.ChatMessagePartTypeText:
+			content = append(content, models.ClaudeContentBlockText{Type: core.CONTENT_TEXT, Text: part.Text})
+		case openai.ChatMessagePartTypeImageURL:
+			if part.ImageURL != nil && part.ImageURL.URL != "" {
+				content = append(content, models.ClaudeContentBlockImage{Type: core.CONTENT_IMAGE, Source: imageSourceFromURL(part.ImageURL.URL)})
+			}
+		}
+	}
+	return content
+}
+
+// imageSourceFromURL turns an image_url into a Claude image source: data URLs become base64
+// sources, anything else a url source.
+func imageSourceFromURL(url string) models.ClaudeImageSource {
+	if rest, ok := strings.CutPrefix(url, "data:"); ok {
+		if mediaType, data, ok := strings.Cut(rest, ";base64,"); ok {
+			return models.ClaudeImageSource{Type: core.SOURCE_BASE64, MediaType: mediaType, Data: data}
+		}
+	}
+	return models.ClaudeImageSource{Type: core.SOURCE_URL, URL: url}
+}
+
+func convertOpenaiAssistantContent(msg openai.ChatCompletionMessage) models.ClaudeContent {
+	content := convertOpenaiContent(msg)
+	for _, toolCall := range msg.ToolCalls {
+		content = append(content, models.ClaudeContentBlockToolUse{
+			Type:  core.CONTENT_TOOL_USE,
+			ID:    toolCall.ID,
+			Name:  toolCall.Function.Name,
+			Input: parseToolArguments(toolCall.Function.Arguments),
+		})
+	}
+	return content
+}
+
+// convertOpenaiToolChoice maps "auto", "required", "none" and {"type": "function", ...} to the
+// Claude tool_choice.
+func convertOpenaiToolChoice(toolChoice any) map[string]any {
+	switch choice := toolChoice.(type) {
+	case string:
+		switch choice {
+		case "required":
+			return map[string]any{"type": "any"}
+		case "none":
+			return map[string]any{"type": "none"}
+		case "auto":
+			return map[string]any{"type": "auto"}
+		}
+	case map[string]any:
+		if function, ok := choice["function"].(map[string]any); ok {
+			if name, _ := function["name"].(string); name != "" {
+				return map[string]any{"type": "tool", "name": name}
+			}
+		}
+	}
+	return nil
+}
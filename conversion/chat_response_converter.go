@@ -0,0 +1,111 @@
+package conversion
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+	"github.com/sashabaranov/go-openai"
+)
+
+// claudeResponse holds the fields of a Claude response needed for the OpenAI response. Backends
+// return responses as maps, passthrough responses with fields of their own.
+type claudeResponse struct {
+	ID      string `json:"id"`
+	Content []struct {
+		Type     string          `json:"type"`
+		Text     string          `json:"text"`
+		Thinking string          `json:"thinking"`
+		ID       string          `json:"id"`
+		Name     string          `json:"name"`
+		Input    json.RawMessage `json:"input"`
+	} `json:"content"`
+	StopReason string         `json:"stop_reason"`
+	Usage      map[string]any `json:"usage"`
+}
+
+// ChatCompletionID derives the chat completion id from the Claude message id, which for OpenAI
+// upstreams already is one.
+func ChatCompletionID(messageID string) string {
+	if strings.HasPrefix(messageID, "chatcmpl-") {
+		return messageID
+	}
+	return "chatcmpl-" + strings.TrimPrefix(messageID, "msg_")
+}
+
+// ConvertClaudeStopReason maps a Claude stop reason to the OpenAI finish reason.
+func ConvertClaudeStopReason(stopReason string) openai.FinishReason {
+	switch stopReason {
+	case core.STOP_MAX_TOKENS:
+		return openai.FinishReasonLength
+	case core.STOP_TOOL_USE:
+		return openai.FinishReasonToolCalls
+	case core.STOP_REFUSAL:
+		return openai.FinishReasonContentFilter
+	}
+	return openai.FinishReasonStop
+}
+
+// ConvertClaudeUsage maps Claude token counts to OpenAI usage. Claude counts cached input
+// separately, OpenAI includes it in the prompt tokens.
+func ConvertClaudeUsage(usage map[string]int) *openai.Usage {
+	cached := usage["cache_read_input_tokens"]
+	promptTokens := usage["input_tokens"] + cached + usage["cache_creation_input_tokens"]
+	return &openai.Usage{
+		PromptTokens:        promptTokens,
+		CompletionTokens:    usage["output_tokens"],
+		TotalTokens:         promptTokens + usage["output_tokens"],
+		PromptTokensDetails: &openai.PromptTokensDetails{CachedTokens: cached},
+	}
+}
+
+// ConvertClaudeToOpenaiResponse converts the Claude response of a backend to a chat completion
+// response for an OpenAI client.
+func ConvertClaudeToOpenaiResponse(claudeResp map[string]any, model string) (openai.ChatCompletionResponse, error) {
+	var response claudeResponse
+	encoded, err := json.Marshal(claudeResp)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	if err := json.Unmarshal(encoded, &response); err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+
+	message := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant}
+	textParts := []string{}
+	thinkingParts := []string{}
+	for _, block := range response.Content {
+		switch block.Type {
+		case core.CONTENT_TEXT:
+			textParts = append(textParts, block.Text)
+		case core.CONTENT_THINKING:
+			thinkingParts = append(thinkingParts, block.Thinking)
+		case core.CONTENT_TOOL_USE:
+			arguments := string(block.Input)
+			if arguments == "" || arguments == "null" {
+				arguments = "{}"
+			}
+			message.ToolCalls = append(message.ToolCalls, openai.ToolCall{
+				ID:       block.ID,
+				Type:     openai.ToolTypeFunction,
+				Function: openai.FunctionCall{Name: block.Name, Arguments: arguments},
+			})
+		}
+	}
+	message.Content = strings.Join(textParts, "")
+	message.ReasoningContent = strings.Join(thinkingParts, "")
+
+	return openai.ChatCompletionResponse{
+		ID:      ChatCompletionID(response.ID),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: []openai.ChatCompletionChoice{{
+			Index:        0,
+			Message:      message,
+			FinishReason: ConvertClaudeStopReason(response.StopReason),
+		}},
+		Usage: *ConvertClaudeUsage(core.TokenCounts(response.Usage)),
+	}, nil
+}
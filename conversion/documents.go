@@ -0,0 +1,237 @@
+package conversion
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+	"github.com/jiaobendaye/go-claude-code-proxy/models"
+	"github.com/ledongthuc/pdf"
+)
+
+// Media types of documents.
+const (
+	MEDIA_TYPE_PDF  = "application/pdf"
+	MEDIA_TYPE_TEXT = "text/plain"
+)
+
+// NativeDocuments reports whether PDF documents go to the upstream of a route as files: its API
+// must take them and its model read them. Other upstreams get the extracted text.
+func NativeDocuments(route core.Route) bool {
+	if route.Provider == nil {
+		return false
+	}
+	switch route.Provider.Type {
+	case core.PROVIDER_GEMINI, core.PROVIDER_RESPONSES:
+		documents := core.GetModelManager().ModelProfile(route.Provider, route.Model).Documents
+		return documents != nil && *documents
+	}
+	return false
+}
+
+// ExtractDocuments replaces the documents of the messages, including those returned by tools,
+// with their text. PDFs outside of tool results, whose outputs only take text, are kept when
+// native is set. URL documents must have been downloaded.
+// The messages themselves are returned when they have no document to replace.
+func ExtractDocuments(messages []models.ClaudeMessage, native bool) ([]models.ClaudeMessage, error) {
+	var extracted []models.ClaudeMessage
+	for i, msg := range messages {
+		content, changed, err := extractDocumentContent(msg.Content, native, fmt.Sprintf("messages.%d.content", i))
+		if err != nil {
+			return nil, err
+		}
+		if !changed {
+			continue
+		}
+		if extracted == nil {
+			extracted = append([]models.ClaudeMessage(nil), messages...)
+		}
+		extracted[i] = models.ClaudeMessage{Role: msg.Role, Content: content}
+	}
+	if extracted == nil {
+		return messages, nil
+	}
+	return extracted, nil
+}
+
+func extractDocumentContent(content models.ClaudeContent, native bool, path string) (models.ClaudeContent, bool, error) {
+	extracted := models.ClaudeContent{}
+	changed := false
+	for i, block := range content {
+		switch block := block.(type) {
+		case models.ClaudeContentBlockDocument:
+			if !native || !isPDF(block.Source) {
+				blocks, err := documentContent(block)
+				if err != nil {
+					return nil, false, &ContentError{Path: fmt.Sprintf("%s.%d.source", path, i), Message: err.Error()}
+				}
+				extracted = append(extracted, blocks...)
+				changed = true
+				continue
+			}
+		case models.ClaudeContentBlockToolResult:
+			items, itemsChanged, err := extractDocumentContent(block.Content, false, fmt.Sprintf("%s.%d.content", path, i))
+			if err != nil {
+				return nil, false, err
+			}
+			if itemsChanged {
+				block.Content = items
+				extracted = append(extracted, block)
+				changed = true
+				continue
+			}
+		}
+		extracted = append(extracted, block)
+	}
+	return extracted, changed, nil
+}
+
+func isPDF(source models.ClaudeDocumentSource) bool {
+	return source.Type == core.SOURCE_BASE64 && source.MediaType == MEDIA_TYPE_PDF
+}
+
+// documentContent returns a document as a text block with its title, context and text, PDFs page
+// by page, followed by the images of content documents.
+func documentContent(doc models.ClaudeContentBlockDocument) (models.ClaudeContent, error) {
+	text := documentHeader(doc)
+	images := models.ClaudeContent{}
+	switch doc.Source.Type {
+	case core.SOURCE_BASE64:
+		data, err := base64.StdEncoding.DecodeString(doc.Source.Data)
+		if err != nil {
+			return nil, fmt.Errorf("data is not valid base64: %v", err)
+		}
+		pages, err := pdfPages(data)
+		if err != nil {
+			return nil, fmt.Errorf("the PDF can't be read: %v", err)
+		}
+		for i, page := range pages {
+			page = strings.TrimSpace(page)
+			if page == "" {
+				page = "[no text on this page, it may be a scan or image]"
+			}
+			text += fmt.Sprintf("[Page %d of %d]\n%s\n", i+1, len(pages), page)
+		}
+	case core.SOURCE_TEXT:
+		text += doc.Source.Data + "\n"
+	case core.SOURCE_CONTENT:
+		for _, block := range doc.Source.Content {
+			switch block := block.(type) {
+			case models.ClaudeContentBlockText:
+				text += block.Text + "\n"
+			case models.ClaudeContentBlockImage:
+				images = append(images, block)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%s documents can't be sent to this model", doc.Source.Type)
+	}
+	text += "[End of document]"
+	return append(models.ClaudeContent{models.ClaudeContentBlockText{Type: core.CONTENT_TEXT, Text: text}}, images...), nil
+}
+
+// documentHeader introduces the text of a document with its title and context, which also goes
+// along with PDFs sent as files.
+func documentHeader(doc models.ClaudeContentBlockDocument) string {
+	header := "[Document]\n"
+	if doc.Title != "" {
+		header = fmt.Sprintf("[Document: %s]\n", doc.Title)
+	}
+	if doc.Context != "" {
+		header += fmt.Sprintf("[Context: %s]\n", doc.Context)
+	}
+	return header
+}
+
+// pdfPages extracts the text of each page of a PDF. The PDF reader panics on some malformed
+// files, which is reported as an error.
+func pdfPages(data []byte) (pages []string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			pages, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i <= reader.NumPage(); i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			pages = append(pages, "")
+			continue
+		}
+		text, err := page.GetPlainText(nil)
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %v", i, err)
+		}
+		pages = append(pages, text)
+	}
+	return pages, nil
+}
+
+func validateDocumentSource(source models.ClaudeDocumentSource) error {
+	switch source.Type {
+	case core.SOURCE_BASE64:
+		if source.MediaType != MEDIA_TYPE_PDF {
+			return fmt.Errorf("media_type %q is not supported for base64 documents, use %s", source.MediaType, MEDIA_TYPE_PDF)
+		}
+		header := make([]byte, 5)
+		n, err := io.ReadFull(base64.NewDecoder(base64.StdEncoding, strings.NewReader(source.Data)), header)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return fmt.Errorf("data is not valid base64: %v", err)
+		}
+		if string(header[:n]) != "%PDF-" {
+			return fmt.Errorf("the document data is not a PDF")
+		}
+	case core.SOURCE_TEXT:
+		if source.MediaType != MEDIA_TYPE_TEXT {
+			return fmt.Errorf("media_type %q is not supported for text documents, use %s", source.MediaType, MEDIA_TYPE_TEXT)
+		}
+	case core.SOURCE_CONTENT:
+		for _, block := range source.Content {
+			switch block := block.(type) {
+			case models.ClaudeContentBlockText:
+			case models.ClaudeContentBlockImage:
+				if err := validateImageSource(block.Source); err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("content documents only take text and image blocks, not %s", block.BlockType())
+			}
+		}
+	case core.SOURCE_URL:
+		return validateSourceURL(source.URL)
+	case core.SOURCE_FILE:
+		if source.FileID == "" {
+			return fmt.Errorf("file_id is empty")
+		}
+	default:
+		return fmt.Errorf("unknown document source type %q", source.Type)
+	}
+	return nil
+}
+
+// documentSources returns the sources of the documents in messages and the tool results in them.
+func documentSources(messages []models.ClaudeMessage) []models.ClaudeDocumentSource {
+	sources := []models.ClaudeDocumentSource{}
+	for _, msg := range messages {
+		for _, block := range msg.Content {
+			switch block := block.(type) {
+			case models.ClaudeContentBlockDocument:
+				sources = append(sources, block.Source)
+			case models.ClaudeContentBlockToolResult:
+				for _, item := range block.Content {
+					if doc, ok := item.(models.ClaudeContentBlockDocument); ok {
+						sources = append(sources, doc.Source)
+					}
+				}
+			}
+		}
+	}
+	return sources
+}
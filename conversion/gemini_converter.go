@@ -0,0 +1,299 @@
+package conversion
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+	"github.com/jiaobendaye/go-claude-code-proxy/models"
+)
+
+// ConvertClaudeToGemini converts a Claude request to a Gemini generateContent request.
+func ConvertClaudeToGemini(claudeRequest *models.ClaudeMessagesRequest, route core.Route) *models.GeminiRequest {
+	geminiRequest := &models.GeminiRequest{Contents: []models.GeminiContent{}}
+
+	if systemText := strings.TrimSpace(core.JoinText(claudeRequest.System, "\n\n")); systemText != "" {
+		geminiRequest.SystemInstruction = &models.GeminiContent{Parts: []models.GeminiPart{{Text: systemText}}}
+	}
+
+	// Function responses are matched by name, which tool results only reference by id
+	toolNames := map[string]string{}
+	for _, msg := range claudeRequest.Messages {
+		for _, block := range msg.Content {
+			if toolUse, ok := block.(models.ClaudeContentBlockToolUse); ok {
+				toolNames[toolUse.ID] = toolUse.Name
+			}
+		}
+	}
+
+	profile := core.GetModelManager().ModelProfile(route.Provider, route.Model)
+	for _, msg := range claudeRequest.Messages {
+		var content models.GeminiContent
+		if msg.Role == core.ROLE_USER {
+			content = convertClaudeUserContent(msg, toolNames, profile)
+		} else if msg.Role == core.ROLE_ASSISTANT {
+			content = convertClaudeModelContent(msg, route)
+		}
+		if len(content.Parts) > 0 {
+			geminiRequest.Contents = append(geminiRequest.Contents, content)
+		}
+	}
+
+	declarations := []models.GeminiFunctionDeclaration{}
+	// Models without tool support don't get tools at all
+	if core.Supports(profile.Tools) {
+		for _, tool := range claudeRequest.Tools {
+			if tool.Name == "" {
+				continue
+			}
+			declaration := models.GeminiFunctionDeclaration{Name: tool.Name, Description: tool.Description}
+			// Parameters without properties are rejected, tools without arguments leave them out
+			if parameters := CleanGeminiSchema(tool.InputSchema); parameters["properties"] != nil {
+				declaration.Parameters = parameters
+			}
+			declarations = append(declarations, declaration)
+		}
+	}
+	if len(declarations) > 0 {
+		geminiRequest.Tools = []models.GeminiTool{{FunctionDeclarations: declarations}}
+	}
+	// A calling config without function declarations is rejected
+	if claudeRequest.ToolChoice != nil && len(declarations) > 0 {
+		config := models.GeminiFunctionCallingConfig{Mode: models.GEMINI_CALLING_AUTO}
+		switch typeVal, _ := claudeRequest.ToolChoice["type"].(string); typeVal {
+		case "any":
+			config.Mode = models.GEMINI_CALLING_ANY
+		case "none":
+			config.Mode = models.GEMINI_CALLING_NONE
+		case "tool":
+			if nameVal, _ := claudeRequest.ToolChoice["name"].(string); nameVal != "" {
+				config = models.GeminiFunctionCallingConfig{Mode: models.GEMINI_CALLING_ANY, AllowedFunctionNames: []string{nameVal}}
+			}
+		}
+		geminiRequest.ToolConfig = &models.GeminiToolConfig{FunctionCallingConfig: config}
+	}
+
+	generationConfig := &models.GeminiGenerationConfig{
+		MaxOutputTokens: ClampMaxTokens(claudeRequest.MaxTokens, route),
+		TopK:            claudeRequest.TopK,
+		StopSequences:   claudeRequest.StopSequences,
+	}
+	if claudeRequest.Temperature != 0 {
+		generationConfig.Temperature = &claudeRequest.Temperature
+	}
+	if claudeRequest.TopP != 0 {
+		generationConfig.TopP = &claudeRequest.TopP
+	}
+	if claudeRequest.Thinking.IsEnabled() {
+		budget := claudeRequest.Thinking.BudgetTokens
+		generationConfig.ThinkingConfig = &models.GeminiThinkingConfig{ThinkingBudget: &budget, IncludeThoughts: true}
+	} else if claudeRequest.Thinking.Type == "disabled" {
+		budget := 0
+		generationConfig.ThinkingConfig = &models.GeminiThinkingConfig{ThinkingBudget: &budget}
+	}
+	geminiRequest.GenerationConfig = generationConfig
+
+	return geminiRequest
+}
+
+// convertClaudeUserContent converts a user message. Failed tool calls answer with an error
+// instead of an output, and the images returned by tools follow the function responses.
+func convertClaudeUserContent(msg models.ClaudeMessage, toolNames map[string]string, profile core.ModelProfile) models.GeminiContent {
+	content := models.GeminiContent{Role: models.GEMINI_ROLE_USER, Parts: []models.GeminiPart{}}
+	for _, block := range withToolResultImages(msg.Content, profile) {
+		switch block := block.(type) {
+		case models.ClaudeContentBlockToolResult:
+			key := "output"
+			if block.IsError {
+				key = "error"
+			}
+			content.Parts = append(content.Parts, models.GeminiPart{FunctionResponse: &models.GeminiFunctionResponse{
+				Name:     toolNames[block.ToolUseID],
+				Response: map[string]any{key: toolResultText(block.Content, profile)},
+			}})
+		case models.ClaudeContentBlockText:
+			content.Parts = append(content.Parts, models.GeminiPart{Text: block.Text})
+		case models.ClaudeContentBlockImage:
+			if block.Source.Type == core.SOURCE_BASE64 && block.Source.MediaType != "" && block.Source.Data != "" {
+				content.Parts = append(content.Parts, models.GeminiPart{InlineData: &models.GeminiBlob{MimeType: block.Source.MediaType, Data: block.Source.Data}})
+			}
+		case models.ClaudeContentBlockDocument:
+			// Only PDFs the model reads are left as documents, see ExtractDocuments
+			if isPDF(block.Source) {
+				content.Parts = append(content.Parts,
+					models.GeminiPart{Text: documentHeader(block)},
+					models.GeminiPart{InlineData: &models.GeminiBlob{MimeType: MEDIA_TYPE_PDF, Data: block.Source.Data}})
+			}
+		}
+	}
+	return content
+}
+
+// convertClaudeModelContent converts an assistant message. Thought signatures restored from
+// thinking blocks go back on the part that followed them in the response.
+func convertClaudeModelContent(msg models.ClaudeMessage, route core.Route) models.GeminiContent {
+	content := models.GeminiContent{Role: models.GEMINI_ROLE_MODEL, Parts: []models.GeminiPart{}}
+	pendingSignature := ""
+	addPart := func(part models.GeminiPart) {
+		part.ThoughtSignature, pendingSignature = pendingSignature, ""
+		content.Parts = append(content.Parts, part)
+	}
+
+	for _, block := range msg.Content {
+		switch block := block.(type) {
+		case models.ClaudeContentBlockThinking:
+			pendingSignature = restoreThoughtSignature(block.Signature, route, pendingSignature)
+		case models.ClaudeContentBlockRedactedThinking:
+			pendingSignature = restoreThoughtSignature(block.Data, route, pendingSignature)
+		case models.ClaudeContentBlockText:
+			if block.Text != "" {
+				addPart(models.GeminiPart{Text: block.Text})
+			}
+		case models.ClaudeContentBlockToolUse:
+			addPart(models.GeminiPart{FunctionCall: &models.GeminiFunctionCall{Name: block.Name, Args: block.Input}})
+		}
+	}
+	return content
+}
+
+func restoreThoughtSignature(signature string, route core.Route, fallback string) string {
+	state, ok := core.ParseSignature(signature)
+	if !ok || state.Kind != core.REASONING_STATE_ENCRYPTED || state.Encrypted == "" || !state.Matches(route) {
+		return fallback
+	}
+	return state.Encrypted
+}
+
+// ThoughtSignature mints the signature carrying a Gemini thought signature of the routed upstream.
+func ThoughtSignature(route core.Route, thoughtSignature string) string {
+	return ReasoningSignature(route, models.ResponsesItem{EncryptedContent: thoughtSignature})
+}
+
+// GeminiToolUseID returns the tool_use id of a function call, which Gemini only sometimes sets.
+func GeminiToolUseID(call *models.GeminiFunctionCall) string {
+	if call.ID != "" {
+		return call.ID
+	}
+	return "toolu_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+}
+
+// ConvertGeminiStopReason maps a Gemini finish reason to the Claude stop reason.
+func ConvertGeminiStopReason(finishReason string, calledTools bool) string {
+	switch finishReason {
+	case models.GEMINI_FINISH_MAX_TOKENS:
+		return core.STOP_MAX_TOKENS
+	case "", models.GEMINI_FINISH_STOP:
+		if calledTools {
+			return core.STOP_TOOL_USE
+		}
+		return core.STOP_END_TURN
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return core.STOP_REFUSAL
+	}
+	if calledTools {
+		return core.STOP_TOOL_USE
+	}
+	return core.STOP_END_TURN
+}
+
+// ConvertGeminiUsage maps Gemini usage metadata to the Claude usage object. Thoughts count as
+// output, like thinking tokens do for Claude.
+func ConvertGeminiUsage(usage *models.GeminiUsageMetadata) map[string]int {
+	if usage == nil {
+		return map[string]int{"input_tokens": 0, "output_tokens": 0}
+	}
+	return map[string]int{
+		"input_tokens":            usage.PromptTokenCount,
+		"output_tokens":           usage.CandidatesTokenCount + usage.ThoughtsTokenCount,
+		"cache_read_input_tokens": usage.CachedContentTokenCount,
+	}
+}
+
+// ConvertGeminiToClaudeResponse converts a generateContent response to Claude format.
+func ConvertGeminiToClaudeResponse(response models.GeminiResponse, originalRequest models.ClaudeMessagesRequest, route core.Route) map[string]any {
+	contentBlocks := []map[string]any{}
+	calledTools := false
+	thinking := strings.Builder{}
+	hasThinking := false
+
+	// Thought text accumulates until a signature or other content ends the thinking block
+	flushThinking := func(signature string) {
+		switch {
+		case hasThinking:
+			contentBlocks = append(contentBlocks, map[string]any{
+				"type":      core.CONTENT_THINKING,
+				"thinking":  thinking.String(),
+				"signature": signature,
+			})
+		case signature != "":
+			contentBlocks = append(contentBlocks, map[string]any{
+				"type": core.CONTENT_REDACTED_THINKING,
+				"data": signature,
+			})
+		}
+		thinking.Reset()
+		hasThinking = false
+	}
+
+	finishReason := ""
+	if len(response.Candidates) > 0 {
+		candidate := response.Candidates[0]
+		finishReason = candidate.FinishReason
+		for _, part := range candidate.Content.Parts {
+			if part.Thought {
+				thinking.WriteString(part.Text)
+				hasThinking = true
+				if part.ThoughtSignature != "" {
+					flushThinking(ThoughtSignature(route, part.ThoughtSignature))
+				}
+				continue
+			}
+			if part.ThoughtSignature != "" {
+				flushThinking(ThoughtSignature(route, part.ThoughtSignature))
+			} else if hasThinking {
+				flushThinking("")
+			}
+			switch {
+			case part.FunctionCall != nil:
+				calledTools = true
+				input := part.FunctionCall.Args
+				if input == nil {
+					input = map[string]any{}
+				}
+				contentBlocks = append(contentBlocks, map[string]any{
+					"type":  core.CONTENT_TOOL_USE,
+					"id":    GeminiToolUseID(part.FunctionCall),
+					"name":  part.FunctionCall.Name,
+					"input": input,
+				})
+			case part.Text != "":
+				if last := len(contentBlocks) - 1; last >= 0 && contentBlocks[last]["type"] == core.CONTENT_TEXT {
+					contentBlocks[last]["text"] = contentBlocks[last]["text"].(string) + part.Text
+				} else {
+					contentBlocks = append(contentBlocks, map[string]any{"type": core.CONTENT_TEXT, "text": part.Text})
+				}
+			}
+		}
+		flushThinking("")
+	} else if response.PromptFeedback != nil && response.PromptFeedback.BlockReason != "" {
+		finishReason = "PROHIBITED_CONTENT"
+	}
+
+	if len(contentBlocks) == 0 {
+		contentBlocks = append(contentBlocks, map[string]any{
+			"type": core.CONTENT_TEXT,
+			"text": "",
+		})
+	}
+
+	return map[string]any{
+		"id":            "msg_" + strings.ReplaceAll(uuid.New().String(), "-", ""),
+		"type":          "message",
+		"role":          "assistant",
+		"model":         originalRequest.Model,
+		"content":       contentBlocks,
+		"stop_reason":   ConvertGeminiStopReason(finishReason, calledTools),
+		"stop_sequence": nil,
+		"usage":         ConvertGeminiUsage(response.UsageMetadata),
+	}
+}
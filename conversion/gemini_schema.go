@@ -0,0 +1,236 @@
+package conversion
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// geminiSchemaKeys are the JSON schema keywords Gemini function declarations accept. Anything
+// else, like additionalProperties or $schema, is rejected by the API.
+var geminiSchemaKeys = map[string]bool{
+	"type": true, "format": true, "title": true, "description": true, "nullable": true,
+	"enum": true, "items": true, "minItems": true, "maxItems": true,
+	"properties": true, "required": true, "propertyOrdering": true,
+	"minimum": true, "maximum": true, "minLength": true, "maxLength": true, "pattern": true,
+	"minProperties": true, "maxProperties": true, "anyOf": true, "default": true, "example": true,
+}
+
+// geminiStringFormats are the only formats Gemini accepts on strings.
+var geminiStringFormats = map[string]bool{"enum": true, "date-time": true}
+
+// geminiMaxRefDepth bounds the inlining of recursive $ref schemas.
+const geminiMaxRefDepth = 3
+
+// CleanGeminiSchema rewrites a tool input schema into the OpenAPI subset Gemini supports:
+// $ref is inlined from $defs/definitions, oneOf becomes anyOf, allOf is merged, const becomes
+// a single value enum, type lists become a type with nullable, and unsupported keywords and
+// string formats are dropped. Objects without properties lose the properties keyword, which
+// Gemini rejects when empty.
+func CleanGeminiSchema(schema map[string]any) map[string]any {
+	if schema == nil {
+		return nil
+	}
+	defs := map[string]any{}
+	for _, key := range []string{"$defs", "definitions"} {
+		if values, ok := schema[key].(map[string]any); ok {
+			for name, def := range values {
+				defs["#/"+key+"/"+name] = def
+			}
+		}
+	}
+	return cleanGeminiSchema(schema, defs, 0)
+}
+
+func cleanGeminiSchema(schema map[string]any, defs map[string]any, depth int) map[string]any {
+	if ref, ok := schema["$ref"].(string); ok {
+		resolved, found := defs[ref].(map[string]any)
+		if !found || depth >= geminiMaxRefDepth {
+			// Unresolvable or too deeply recursive, leave the shape open
+			placeholder := map[string]any{"type": "object"}
+			if description, ok := schema["description"].(string); ok {
+				placeholder["description"] = description
+			}
+			return placeholder
+		}
+		merged := map[string]any{}
+		for key, value := range resolved {
+			merged[key] = value
+		}
+		for key, value := range schema {
+			if key != "$ref" {
+				merged[key] = value
+			}
+		}
+		return cleanGeminiSchema(merged, defs, depth+1)
+	}
+
+	// Keys are visited in order, so that keywords filling the same key always resolve the same way
+	cleaned := map[string]any{}
+	for _, key := range sortedSchemaKeys(schema) {
+		value := schema[key]
+		switch key {
+		case "oneOf", "anyOf":
+			members, nullable := cleanGeminiSchemaList(value, defs, depth)
+			if nullable {
+				cleaned["nullable"] = true
+			}
+			if len(members) == 1 {
+				// Optional[T] style unions collapse into T
+				mergeGeminiSchema(cleaned, members[0])
+			} else if len(members) > 1 {
+				cleaned["anyOf"] = members
+			}
+		case "allOf":
+			members, _ := cleanGeminiSchemaList(value, defs, depth)
+			for _, member := range members {
+				mergeGeminiSchema(cleaned, member)
+			}
+		case "const":
+			cleaned["enum"] = []any{fmt.Sprint(value)}
+		case "enum":
+			// Gemini enums are strings
+			if values, ok := value.([]any); ok {
+				enum := []any{}
+				for _, v := range values {
+					if v != nil {
+						enum = append(enum, fmt.Sprint(v))
+					}
+				}
+				cleaned["enum"] = enum
+			}
+		case "type":
+			if types, ok := value.([]any); ok {
+				for _, t := range types {
+					if t == "null" {
+						cleaned["nullable"] = true
+					} else if _, set := cleaned["type"]; !set {
+						cleaned["type"] = t
+					}
+				}
+			} else {
+				cleaned["type"] = value
+			}
+		case "properties":
+			if properties, ok := value.(map[string]any); ok && len(properties) > 0 {
+				cleanedProperties := map[string]any{}
+				for name, property := range properties {
+					if propertySchema, ok := property.(map[string]any); ok {
+						cleanedProperties[name] = cleanGeminiSchema(propertySchema, defs, depth)
+					}
+				}
+				// Properties merged from allOf or a collapsed anyOf are kept
+				if len(cleanedProperties) > 0 {
+					mergeGeminiSchema(cleaned, map[string]any{"properties": cleanedProperties})
+				}
+			}
+		case "items":
+			if items, ok := value.(map[string]any); ok {
+				cleaned["items"] = cleanGeminiSchema(items, defs, depth)
+			}
+		case "required":
+			// Malformed lists are dropped rather than sent
+			if required, ok := value.([]any); ok {
+				mergeGeminiSchema(cleaned, map[string]any{"required": required})
+			}
+		default:
+			if geminiSchemaKeys[key] {
+				cleaned[key] = value
+			}
+		}
+	}
+
+	if format, ok := cleaned["format"].(string); ok && cleaned["type"] == "string" && !geminiStringFormats[format] {
+		delete(cleaned, "format")
+	}
+	if enum, ok := cleaned["enum"]; ok {
+		// Enums of other types are sent as strings
+		cleaned["type"] = "string"
+		cleaned["format"] = "enum"
+		cleaned["enum"] = enum
+	}
+	// required may only name declared properties
+	if required, ok := cleaned["required"].([]any); ok {
+		properties, _ := cleaned["properties"].(map[string]any)
+		kept := []any{}
+		seen := map[string]bool{}
+		for _, name := range required {
+			if _, declared := properties[fmt.Sprint(name)]; declared && !seen[fmt.Sprint(name)] {
+				seen[fmt.Sprint(name)] = true
+				kept = append(kept, name)
+			}
+		}
+		if len(kept) > 0 {
+			cleaned["required"] = kept
+		} else {
+			delete(cleaned, "required")
+		}
+	}
+	if t, ok := cleaned["type"].(string); ok {
+		cleaned["type"] = strings.ToLower(t)
+	}
+	return cleaned
+}
+
+// cleanGeminiSchemaList cleans the members of a union, reporting {"type": "null"} members
+// separately since Gemini expresses them with nullable. Members that aren't schemas are skipped.
+func cleanGeminiSchemaList(value any, defs map[string]any, depth int) ([]map[string]any, bool) {
+	members, _ := value.([]any)
+	cleaned := []map[string]any{}
+	nullable := false
+	for _, member := range members {
+		if memberSchema, ok := member.(map[string]any); ok {
+			if memberSchema["type"] == "null" {
+				nullable = true
+				continue
+			}
+			cleaned = append(cleaned, cleanGeminiSchema(memberSchema, defs, depth))
+		}
+	}
+	return cleaned, nullable
+}
+
+// mergeGeminiSchema merges an allOf member, or the properties and required of a schema, into a
+// schema, combining properties and required.
+func mergeGeminiSchema(into, member map[string]any) {
+	for _, key := range sortedSchemaKeys(member) {
+		value := member[key]
+		switch key {
+		case "properties":
+			memberProperties, ok := value.(map[string]any)
+			if !ok {
+				continue
+			}
+			properties, _ := into["properties"].(map[string]any)
+			if properties == nil {
+				properties = map[string]any{}
+			}
+			for name, property := range memberProperties {
+				properties[name] = property
+			}
+			into["properties"] = properties
+		case "required":
+			required, ok := value.([]any)
+			if !ok {
+				continue
+			}
+			existing, _ := into["required"].([]any)
+			// A fresh list, the existing one may be the client's
+			into["required"] = append(append([]any{}, existing...), required...)
+		default:
+			if _, set := into[key]; !set {
+				into[key] = value
+			}
+		}
+	}
+}
+
+// sortedSchemaKeys returns the keys of a schema in sorted order.
+func sortedSchemaKeys(schema map[string]any) []string {
+	keys := make([]string, 0, len(schema))
+	for key := range schema {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
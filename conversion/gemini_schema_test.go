@@ -0,0 +1,65 @@
+package conversion
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCleanGeminiSchema(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		want   string
+	}{
+		{
+			name:   "allOf merged with sibling properties",
+			schema: `{"allOf":[{"properties":{"a":{"type":"string"}},"required":["a"]}],"properties":{"b":{"type":"string"}},"required":["b"]}`,
+			want:   `{"properties":{"a":{"type":"string"},"b":{"type":"string"}},"required":["a","b"]}`,
+		},
+		{
+			name:   "optional anyOf collapsed with sibling properties",
+			schema: `{"anyOf":[{"properties":{"a":{"type":"string"}},"required":["a"]},{"type":"null"}],"properties":{"b":{"type":"string"}},"required":["b","a"]}`,
+			want:   `{"nullable":true,"properties":{"a":{"type":"string"},"b":{"type":"string"}},"required":["a","b"]}`,
+		},
+		{
+			name:   "required limited to declared properties",
+			schema: `{"type":"object","properties":{"a":{"type":"string"}},"required":["a","missing"]}`,
+			want:   `{"properties":{"a":{"type":"string"}},"required":["a"],"type":"object"}`,
+		},
+		{
+			name:   "unsupported keywords dropped",
+			schema: `{"$schema":"x","type":"object","additionalProperties":false,"properties":{"s":{"type":"string","format":"uri"}}}`,
+			want:   `{"properties":{"s":{"type":"string"}},"type":"object"}`,
+		},
+		{
+			name:   "const and type lists",
+			schema: `{"type":["integer","null"],"const":3}`,
+			want:   `{"enum":["3"],"format":"enum","nullable":true,"type":"string"}`,
+		},
+		{
+			name:   "ref inlined",
+			schema: `{"$defs":{"p":{"type":"string"}},"properties":{"a":{"$ref":"#/$defs/p"}}}`,
+			want:   `{"properties":{"a":{"type":"string"}}}`,
+		},
+		{
+			name:   "malformed members skipped",
+			schema: `{"allOf":["x",{"properties":"y","required":"z"}],"properties":{"a":1},"required":{"a":true}}`,
+			want:   `{}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var schema map[string]any
+			if err := json.Unmarshal([]byte(tt.schema), &schema); err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.Marshal(CleanGeminiSchema(schema))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("CleanGeminiSchema(%s) = %s, want %s", tt.schema, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package conversion
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"slices"
+
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+	"github.com/jiaobendaye/go-claude-code-proxy/models"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// JPEG qualities tried in turn to bring an image under the byte cap, before scaling it down further.
+var jpegQualities = []int{85, 70, 55, 40}
+
+// minImageEdge is the size below which an image isn't scaled down further to fit the byte cap.
+const minImageEdge = 64
+
+// maxDecodedImagePixels bounds the images decoded to be fitted. Decoding takes memory for every
+// pixel the header claims, which a small file can set to billions.
+const maxDecodedImagePixels = 100_000_000
+
+// NormalizeImages fits the base64 images of the messages, including those returned by tools, to
+// the image limits of a model: larger images are scaled down, formats the model doesn't take
+// converted, and images over the byte cap re-encoded until they fit. Images within the limits are
+// kept as sent. URL images must have been downloaded to be fitted.
+// The messages themselves are returned when no image changed.
+func NormalizeImages(messages []models.ClaudeMessage, limits core.ImageLimits) ([]models.ClaudeMessage, error) {
+	var normalized []models.ClaudeMessage
+	for i, msg := range messages {
+		content, changed, err := normalizeImageContent(msg.Content, limits, fmt.Sprintf("messages.%d.content", i))
+		if err != nil {
+			return nil, err
+		}
+		if !changed {
+			continue
+		}
+		if normalized == nil {
+			normalized = append([]models.ClaudeMessage(nil), messages...)
+		}
+		normalized[i] = models.ClaudeMessage{Role: msg.Role, Content: content}
+	}
+	if normalized == nil {
+		return messages, nil
+	}
+	return normalized, nil
+}
+
+func normalizeImageContent(content models.ClaudeContent, limits core.ImageLimits, path string) (models.ClaudeContent, bool, error) {
+	normalized := models.ClaudeContent{}
+	changed := false
+	for i, block := range content {
+		switch block := block.(type) {
+		case models.ClaudeContentBlockImage:
+			source, sourceChanged, err := normalizeImage(block.Source, limits)
+			if err != nil {
+				return nil, false, &ContentError{Path: fmt.Sprintf("%s.%d.source", path, i), Message: err.Error()}
+			}
+			if sourceChanged {
+				block.Source = source
+				normalized = append(normalized, block)
+				changed = true
+				continue
+			}
+		case models.ClaudeContentBlockToolResult:
+			items, itemsChanged, err := normalizeImageContent(block.Content, limits, fmt.Sprintf("%s.%d.content", path, i))
+			if err != nil {
+				return nil, false, err
+			}
+			if itemsChanged {
+				block.Content = items
+				normalized = append(normalized, block)
+				changed = true
+				continue
+			}
+		}
+		normalized = append(normalized, block)
+	}
+	return normalized, changed, nil
+}
+
+// normalizeImage fits one image source to the limits, reporting whether it had to be changed.
+func normalizeImage(source models.ClaudeImageSource, limits core.ImageLimits) (models.ClaudeImageSource, bool, error) {
+	if source.Type != core.SOURCE_BASE64 {
+		return source, false, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(source.Data)
+	if err != nil {
+		return source, false, fmt.Errorf("data is not valid base64: %v", err)
+	}
+	accepted := slices.Contains(limits.Formats, source.MediaType)
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		// Images the proxy can't read, like animated WebP, are only an error when they must change
+		if accepted && len(data) <= limits.MaxBytes {
+			return source, false, nil
+		}
+		return source, false, fmt.Errorf("the image can't be decoded to fit the model: %v", err)
+	}
+	width, height := fitImageSize(config.Width, config.Height, limits)
+	if accepted && width == config.Width && height == config.Height && len(data) <= limits.MaxBytes {
+		return source, false, nil
+	}
+
+	if int64(config.Width)*int64(config.Height) > maxDecodedImagePixels {
+		return source, false, fmt.Errorf("the image is %dx%d pixels, images over %d pixels can't be fitted to the model",
+			config.Width, config.Height, maxDecodedImagePixels)
+	}
+	// Animated GIFs decode to their first frame
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return source, false, fmt.Errorf("the image can't be decoded to fit the model: %v", err)
+	}
+	encoded, mediaType, err := encodeImage(img, width, height, source.MediaType, limits)
+	if err != nil {
+		return source, false, err
+	}
+	return models.ClaudeImageSource{
+		Type:      core.SOURCE_BASE64,
+		MediaType: mediaType,
+		Data:      base64.StdEncoding.EncodeToString(encoded),
+	}, true, nil
+}
+
+// fitImageSize returns the size of an image scaled down, keeping its aspect ratio, to the longest
+// edge and pixel budget of the limits.
+func fitImageSize(width, height int, limits core.ImageLimits) (int, int) {
+	scale := 1.0
+	if limits.MaxEdge > 0 {
+		scale = min(scale, float64(limits.MaxEdge)/float64(max(width, height)))
+	}
+	if limits.MaxPixels > 0 {
+		scale = min(scale, math.Sqrt(float64(limits.MaxPixels)/(float64(width)*float64(height))))
+	}
+	if scale >= 1 {
+		return width, height
+	}
+	return max(1, int(float64(width)*scale)), max(1, int(float64(height)*scale))
+}
+
+// encodeImage encodes an image at a size in a format the model takes, under its byte cap. PNG and
+// GIF images, mostly screenshots and diagrams, stay lossless PNG while that fits; other images and
+// PNGs too large become JPEG at decreasing qualities. What still doesn't fit is scaled down further.
+func encodeImage(img image.Image, width, height int, mediaType string, limits core.ImageLimits) ([]byte, string, error) {
+	takesPNG := slices.Contains(limits.Formats, "image/png")
+	takesJPEG := slices.Contains(limits.Formats, "image/jpeg")
+	lossless := takesPNG && (mediaType == "image/png" || mediaType == "image/gif" || !takesJPEG)
+	for {
+		// Every attempt scales the original, not the previous attempt
+		scaled := scaleImage(img, width, height)
+		var buf bytes.Buffer
+		if lossless {
+			if err := png.Encode(&buf, scaled); err != nil {
+				return nil, "", fmt.Errorf("the image can't be encoded: %v", err)
+			}
+			if buf.Len() <= limits.MaxBytes {
+				return buf.Bytes(), "image/png", nil
+			}
+		}
+		if takesJPEG {
+			flattened := opaqueImage(scaled)
+			for _, quality := range jpegQualities {
+				buf.Reset()
+				if err := jpeg.Encode(&buf, flattened, &jpeg.Options{Quality: quality}); err != nil {
+					return nil, "", fmt.Errorf("the image can't be encoded: %v", err)
+				}
+				if buf.Len() <= limits.MaxBytes {
+					return buf.Bytes(), "image/jpeg", nil
+				}
+			}
+		}
+		if max(width, height) <= minImageEdge {
+			return nil, "", fmt.Errorf("the image can't be made smaller than %d bytes", limits.MaxBytes)
+		}
+		width, height = max(1, width*3/4), max(1, height*3/4)
+	}
+}
+
+// scaleImage resizes an image, returning it unchanged when it already has the size.
+func scaleImage(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() == width && bounds.Dy() == height {
+		return img
+	}
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), img, bounds, draw.Src, nil)
+	return scaled
+}
+
+// opaqueImage puts an image with transparency on a white background, JPEG has no alpha channel.
+func opaqueImage(img image.Image) image.Image {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		return img
+	}
+	bounds := img.Bounds()
+	flattened := image.NewRGBA(bounds)
+	draw.Draw(flattened, bounds, image.White, image.Point{}, draw.Src)
+	draw.Draw(flattened, bounds, img, bounds.Min, draw.Over)
+	return flattened
+}
@@ -0,0 +1,148 @@
+package conversion
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+	"github.com/jiaobendaye/go-claude-code-proxy/models"
+)
+
+// imageMediaTypes are the image media types Claude accepts.
+var imageMediaTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+// IsImageMediaType reports whether Claude accepts images of a media type.
+func IsImageMediaType(mediaType string) bool {
+	return slices.Contains(imageMediaTypes, mediaType)
+}
+
+// ContentError reports an invalid content block, found before the request is routed. It is
+// reported as an invalid_request_error.
+type ContentError struct {
+	Path    string
+	Message string
+}
+
+func (e *ContentError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidateContent checks the images and documents of the messages, including those returned by
+// tools, the way the Anthropic API does: base64 images need a supported media type matching their
+// data, base64 documents PDF data, URL sources an http(s) URL and file sources a file id.
+func ValidateContent(messages []models.ClaudeMessage) error {
+	for i, msg := range messages {
+		for j, block := range msg.Content {
+			path := fmt.Sprintf("messages.%d.content.%d", i, j)
+			if err := validateSource(block); err != nil {
+				return &ContentError{Path: path + ".source", Message: err.Error()}
+			}
+			if toolResult, ok := block.(models.ClaudeContentBlockToolResult); ok {
+				for k, item := range toolResult.Content {
+					if err := validateSource(item); err != nil {
+						return &ContentError{Path: fmt.Sprintf("%s.content.%d.source", path, k), Message: err.Error()}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// validateSource checks the source of an image or document block.
+func validateSource(block models.ClaudeContentBlock) error {
+	switch block := block.(type) {
+	case models.ClaudeContentBlockImage:
+		return validateImageSource(block.Source)
+	case models.ClaudeContentBlockDocument:
+		return validateDocumentSource(block.Source)
+	}
+	return nil
+}
+
+func validateImageSource(source models.ClaudeImageSource) error {
+	switch source.Type {
+	case core.SOURCE_BASE64:
+		if !IsImageMediaType(source.MediaType) {
+			return fmt.Errorf("media_type %q is not supported, use one of %s", source.MediaType, strings.Join(imageMediaTypes, ", "))
+		}
+		if source.Data == "" {
+			return fmt.Errorf("data is empty")
+		}
+		// Only the start of the data is decoded, enough to tell its type
+		header := make([]byte, 512)
+		n, err := io.ReadFull(base64.NewDecoder(base64.StdEncoding, strings.NewReader(source.Data)), header)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return fmt.Errorf("data is not valid base64: %v", err)
+		}
+		if detected := http.DetectContentType(header[:n]); strings.HasPrefix(detected, "image/") && detected != source.MediaType {
+			return fmt.Errorf("the image data is %s, not the declared media_type %s", detected, source.MediaType)
+		}
+	case core.SOURCE_URL:
+		return validateSourceURL(source.URL)
+	case core.SOURCE_FILE:
+		if source.FileID == "" {
+			return fmt.Errorf("file_id is empty")
+		}
+	default:
+		return fmt.Errorf("unknown image source type %q", source.Type)
+	}
+	return nil
+}
+
+func validateSourceURL(sourceURL string) error {
+	parsed, err := url.Parse(sourceURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("url %q is not an http or https URL", sourceURL)
+	}
+	return nil
+}
+
+// imageSourceURL returns the URL an image is sent as to upstreams taking image URLs: a data URL
+// for base64 images, the URL itself for URL images. File images have none.
+func imageSourceURL(source models.ClaudeImageSource) string {
+	switch source.Type {
+	case core.SOURCE_BASE64:
+		if source.MediaType != "" && source.Data != "" {
+			return "data:" + source.MediaType + ";base64," + source.Data
+		}
+	case core.SOURCE_URL:
+		return source.URL
+	}
+	return ""
+}
+
+// imageSources returns the sources of the images in messages and in their content documents, and
+// of those returned by tools when toolResults is set.
+func imageSources(messages []models.ClaudeMessage, toolResults bool) []models.ClaudeImageSource {
+	sources := []models.ClaudeImageSource{}
+	for _, msg := range messages {
+		for _, block := range msg.Content {
+			switch block := block.(type) {
+			case models.ClaudeContentBlockImage:
+				sources = append(sources, block.Source)
+			case models.ClaudeContentBlockDocument:
+				for _, item := range block.Source.Content {
+					if image, ok := item.(models.ClaudeContentBlockImage); ok {
+						sources = append(sources, image.Source)
+					}
+				}
+			case models.ClaudeContentBlockToolResult:
+				if !toolResults {
+					continue
+				}
+				for _, item := range block.Content {
+					if image, ok := item.(models.ClaudeContentBlockImage); ok {
+						sources = append(sources, image.Source)
+					}
+				}
+			}
+		}
+	}
+	return sources
+}
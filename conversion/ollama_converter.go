@@ -0,0 +1,239 @@
+package conversion
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+	"github.com/jiaobendaye/go-claude-code-proxy/models"
+)
+
+// ConvertClaudeToOllama converts a Claude request to an Ollama /api/chat request, applying the
+// provider's settings for the routed model.
+func ConvertClaudeToOllama(claudeRequest *models.ClaudeMessagesRequest, route core.Route) *models.OllamaChatRequest {
+	ollamaRequest := &models.OllamaChatRequest{
+		Model:    route.Model,
+		Messages: []models.OllamaMessage{},
+		Stream:   claudeRequest.Stream,
+	}
+
+	if systemText := strings.TrimSpace(core.JoinText(claudeRequest.System, "\n\n")); systemText != "" {
+		ollamaRequest.Messages = append(ollamaRequest.Messages, models.OllamaMessage{Role: core.ROLE_SYSTEM, Content: systemText})
+	}
+
+	// Tool messages name the tool they answer, tool results only reference it by id
+	toolNames := map[string]string{}
+	for _, msg := range claudeRequest.Messages {
+		for _, block := range msg.Content {
+			if toolUse, ok := block.(models.ClaudeContentBlockToolUse); ok {
+				toolNames[toolUse.ID] = toolUse.Name
+			}
+		}
+	}
+
+	profile := core.GetModelManager().ModelProfile(route.Provider, route.Model)
+	for _, msg := range claudeRequest.Messages {
+		if msg.Role == core.ROLE_USER {
+			ollamaRequest.Messages = append(ollamaRequest.Messages, convertClaudeToOllamaUserMessages(msg, toolNames, profile)...)
+		} else if msg.Role == core.ROLE_ASSISTANT {
+			ollamaRequest.Messages = append(ollamaRequest.Messages, convertClaudeToOllamaAssistantMessage(msg, route))
+		}
+	}
+
+	// Models without tool support don't get tools at all
+	if core.Supports(profile.Tools) {
+		for _, tool := range claudeRequest.Tools {
+			if tool.Name == "" {
+				continue
+			}
+			ollamaTool := models.OllamaTool{Type: core.TOOL_FUNCTION}
+			ollamaTool.Function.Name = tool.Name
+			ollamaTool.Function.Description = tool.Description
+			ollamaTool.Function.Parameters = tool.InputSchema
+			ollamaRequest.Tools = append(ollamaRequest.Tools, ollamaTool)
+		}
+	}
+
+	modelOptions := core.OllamaModelOptions{}
+	if route.Provider != nil {
+		modelOptions = route.Provider.OllamaOptions(route.Model)
+	}
+	options := map[string]any{"num_predict": ClampMaxTokens(claudeRequest.MaxTokens, route)}
+	if claudeRequest.Temperature != 0 {
+		options["temperature"] = claudeRequest.Temperature
+	}
+	if claudeRequest.TopP != 0 {
+		options["top_p"] = claudeRequest.TopP
+	}
+	if claudeRequest.TopK != 0 {
+		options["top_k"] = claudeRequest.TopK
+	}
+	if len(claudeRequest.StopSequences) > 0 {
+		options["stop"] = claudeRequest.StopSequences
+	}
+	if modelOptions.NumCtx > 0 {
+		options["num_ctx"] = modelOptions.NumCtx
+	}
+	for key, value := range modelOptions.Options {
+		options[key] = value
+	}
+	ollamaRequest.Options = options
+	ollamaRequest.KeepAlive = modelOptions.KeepAlive
+	ollamaRequest.Think = ollamaThink(claudeRequest.Thinking, route, modelOptions)
+
+	return ollamaRequest
+}
+
+// ollamaThink picks the think field. Models without thinking support reject think=true, so it is
+// only sent when the Claude request sets thinking or the model settings override it.
+func ollamaThink(thinking models.ClaudeThinkingConfig, route core.Route, modelOptions core.OllamaModelOptions) any {
+	if modelOptions.Think != nil {
+		return modelOptions.Think
+	}
+	if route.Provider != nil && route.Provider.Reasoning == core.REASONING_NONE {
+		return nil
+	}
+	switch {
+	case thinking.IsEnabled() && core.ReasoningStyle(route.Provider, route.Model) == core.REASONING_EFFORT:
+		return core.ReasoningEffortForBudget(thinking.BudgetTokens)
+	case thinking.IsEnabled():
+		return true
+	case thinking.Type == "disabled":
+		return false
+	}
+	return nil
+}
+
+// convertClaudeToOllamaUserMessages converts a user message into tool messages for its tool
+// results, followed by a user message with its text and base64 images, including those the tools
+// returned.
+func convertClaudeToOllamaUserMessages(msg models.ClaudeMessage, toolNames map[string]string, profile core.ModelProfile) []models.OllamaMessage {
+	messages := []models.OllamaMessage{}
+	userMessage := models.OllamaMessage{Role: core.ROLE_USER}
+	textParts := []string{}
+	for _, block := range withToolResultImages(msg.Content, profile) {
+		switch block := block.(type) {
+		case models.ClaudeContentBlockToolResult:
+			messages = append(messages, models.OllamaMessage{
+				Role:     core.ROLE_TOOL,
+				Content:  toolResultOutput(block, profile),
+				ToolName: toolNames[block.ToolUseID],
+			})
+		case models.ClaudeContentBlockText:
+			textParts = append(textParts, block.Text)
+		case models.ClaudeContentBlockImage:
+			if block.Source.Type == core.SOURCE_BASE64 && block.Source.Data != "" {
+				userMessage.Images = append(userMessage.Images, block.Source.Data)
+			}
+		}
+	}
+	userMessage.Content = strings.Join(textParts, "\n")
+	if userMessage.Content != "" || len(userMessage.Images) > 0 || len(messages) == 0 {
+		messages = append(messages, userMessage)
+	}
+	return messages
+}
+
+func convertClaudeToOllamaAssistantMessage(msg models.ClaudeMessage, route core.Route) models.OllamaMessage {
+	ret := models.OllamaMessage{Role: core.ROLE_ASSISTANT}
+	textParts := []string{}
+	thinkingParts := []string{}
+	for _, block := range msg.Content {
+		switch block := block.(type) {
+		case models.ClaudeContentBlockText:
+			textParts = append(textParts, block.Text)
+		case models.ClaudeContentBlockThinking:
+			// The raw thinking goes back to the model that produced it, like reasoning_content
+			if state, ok := core.ParseSignature(block.Signature); ok && state.Kind == core.REASONING_STATE_CONTENT && state.Matches(route) {
+				thinkingParts = append(thinkingParts, block.Thinking)
+			}
+		case models.ClaudeContentBlockToolUse:
+			toolCall := models.OllamaToolCall{ID: block.ID}
+			toolCall.Function.Name = block.Name
+			toolCall.Function.Arguments = block.Input
+			if toolCall.Function.Arguments == nil {
+				toolCall.Function.Arguments = map[string]any{}
+			}
+			ret.ToolCalls = append(ret.ToolCalls, toolCall)
+		}
+	}
+	ret.Content = strings.Join(textParts, "")
+	ret.Thinking = strings.Join(thinkingParts, "")
+	return ret
+}
+
+// OllamaToolUseID returns the tool_use id of a tool call, which older Ollama versions don't set.
+func OllamaToolUseID(toolCall models.OllamaToolCall) string {
+	if toolCall.ID != "" {
+		return toolCall.ID
+	}
+	return "toolu_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+}
+
+// ConvertOllamaStopReason maps an Ollama done_reason to the Claude stop reason.
+func ConvertOllamaStopReason(doneReason string, calledTools bool) string {
+	if doneReason == models.OLLAMA_DONE_LENGTH {
+		return core.STOP_MAX_TOKENS
+	}
+	if calledTools {
+		return core.STOP_TOOL_USE
+	}
+	return core.STOP_END_TURN
+}
+
+// ConvertOllamaUsage maps the token counts of a finished Ollama response to the Claude usage object.
+func ConvertOllamaUsage(response models.OllamaChatResponse) map[string]int {
+	return map[string]int{
+		"input_tokens":  response.PromptEvalCount,
+		"output_tokens": response.EvalCount,
+	}
+}
+
+// ConvertOllamaToClaudeResponse converts a non streaming /api/chat response to Claude format.
+func ConvertOllamaToClaudeResponse(response models.OllamaChatResponse, originalRequest models.ClaudeMessagesRequest, route core.Route) map[string]any {
+	contentBlocks := []map[string]any{}
+	message := response.Message
+
+	if message.Thinking != "" {
+		contentBlocks = append(contentBlocks, map[string]any{
+			"type":      core.CONTENT_THINKING,
+			"thinking":  message.Thinking,
+			"signature": ThinkingSignature(route),
+		})
+	}
+	if message.Content != "" {
+		contentBlocks = append(contentBlocks, map[string]any{
+			"type": core.CONTENT_TEXT,
+			"text": message.Content,
+		})
+	}
+	for _, toolCall := range message.ToolCalls {
+		input := toolCall.Function.Arguments
+		if input == nil {
+			input = map[string]any{}
+		}
+		contentBlocks = append(contentBlocks, map[string]any{
+			"type":  core.CONTENT_TOOL_USE,
+			"id":    OllamaToolUseID(toolCall),
+			"name":  toolCall.Function.Name,
+			"input": input,
+		})
+	}
+	if len(contentBlocks) == 0 {
+		contentBlocks = append(contentBlocks, map[string]any{
+			"type": core.CONTENT_TEXT,
+			"text": "",
+		})
+	}
+
+	return map[string]any{
+		"id":            "msg_" + strings.ReplaceAll(uuid.New().String(), "-", ""),
+		"type":          "message",
+		"role":          "assistant",
+		"model":         originalRequest.Model,
+		"content":       contentBlocks,
+		"stop_reason":   ConvertOllamaStopReason(response.DoneReason, len(message.ToolCalls) > 0),
+		"stop_sequence": nil,
+		"usage":         ConvertOllamaUsage(response),
+	}
+}
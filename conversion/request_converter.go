@@ -3,7 +3,6 @@ package conversion
 import (
 	"encoding/json"
 	"fmt"
-	"math"
 	"strings"
 
 	"github.com/jiaobendaye/go-claude-code-proxy/core"
@@ -11,68 +10,47 @@ import (
 	"github.com/sashabaranov/go-openai"
 )
 
-func ConvertClaudeToOpenai(claudeRequest *models.ClaudeMessagesRequest, modelManager *core.ModelManager) *openai.ChatCompletionRequest {
+// ConvertClaudeToOpenai converts a Claude request to a chat completion request, shaped by the
+// profile of the upstream model: parameters it rejects are renamed or dropped.
+func ConvertClaudeToOpenai(claudeRequest *models.ClaudeMessagesRequest, route core.Route) *openai.ChatCompletionRequest {
+	profile := core.GetModelManager().ModelProfile(route.Provider, route.Model)
 	convertedMessages := []openai.ChatCompletionMessage{}
 
-	// Add system message if present
-	if claudeRequest.System != nil {
-		var systemText string
-		if text, ok := claudeRequest.System.(string); ok {
-			systemText = text
-		} else if blocks, ok := claudeRequest.System.([]interface{}); ok {
-			textParts := []string{}
-			for _, block := range blocks {
-				if textBlock, blockOk := block.(models.ClaudeContentBlockText); blockOk {
-					textParts = append(textParts, textBlock.Text)
-				} else if blockMap, blockMapOk := block.(map[string]interface{}); blockMapOk {
-					if text, ok := blockMap["text"].(string); blockMap["type"] == core.CONTENT_TEXT && ok {
-						textParts = append(textParts, text)
-					}
-				}
-			}
-			systemText = strings.Join(textParts, "\n\n")
-		}
-		if strings.TrimSpace(systemText) != "" {
-			convertedMessages = append(convertedMessages, openai.ChatCompletionMessage{
-				Role:    core.ROLE_SYSTEM,
-				Content: strings.TrimSpace(systemText),
-			})
+	// Add system message if present; models without system messages get it folded into the first
+	// user message once the messages are converted
+	systemText := strings.TrimSpace(core.JoinText(claudeRequest.System, "\n\n"))
+	if systemText != "" && profile.SystemRole != core.SYSTEM_ROLE_USER {
+		role := core.ROLE_SYSTEM
+		if profile.SystemRole != "" {
+			role = profile.SystemRole
 		}
+		convertedMessages = append(convertedMessages, openai.ChatCompletionMessage{
+			Role:    role,
+			Content: systemText,
+		})
 	}
 
-	for i, msg := range claudeRequest.Messages {
+	for _, msg := range claudeRequest.Messages {
 		if msg.Role == core.ROLE_USER {
-			convertedMessages = append(convertedMessages, *convertClaudeUserMessage(msg))
-		} else if msg.Role == core.ROLE_ASSISTANT {
-			convertedMessages = append(convertedMessages, *convertClaudeAssistantMessage(msg))
-
-			// Check if next message contains tool results
-			if i+1 < len(claudeRequest.Messages) {
-				nextMsg := claudeRequest.Messages[i+1]
-				if nextMsg.Role == core.ROLE_USER {
-					if _, ok := nextMsg.Content.([]any); ok {
-						hasToolResult := false
-						for _, block := range nextMsg.Content.([]any) {
-							if val, ok := core.GetField(block, "type"); ok && val == core.CONTENT_TOOL_RESULT {
-								hasToolResult = true
-								break
-							}
-						}
-						if hasToolResult {
-							// Process tool results
-							toolResultMessages := convertClaudeToolResultMessage(nextMsg)
-							convertedMessages = append(convertedMessages, toolResultMessages...)
-							i++ // Skip processing the tool result message in the next iteration
-						}
-					}
-				}
+			// Tool results answer the preceding assistant tool calls and must directly follow it
+			if core.HasBlockType(msg.Content, core.CONTENT_TOOL_RESULT) {
+				convertedMessages = append(convertedMessages, convertClaudeToolResultMessage(msg, profile)...)
+			}
+			msg.Content = withToolResultImages(msg.Content, profile)
+			if userMessage := convertClaudeUserMessage(msg); userMessage != nil {
+				convertedMessages = append(convertedMessages, *userMessage)
 			}
+		} else if msg.Role == core.ROLE_ASSISTANT {
+			convertedMessages = append(convertedMessages, *convertClaudeAssistantMessage(msg, route))
 		}
 	}
+	if systemText != "" && profile.SystemRole == core.SYSTEM_ROLE_USER {
+		convertedMessages = foldSystemPrompt(convertedMessages, systemText)
+	}
 
-	// Convert tools
+	// Convert tools, which models without tool support don't get at all
 	var openaiTools []openai.Tool
-	if claudeRequest.Tools != nil {
+	if claudeRequest.Tools != nil && core.Supports(profile.Tools) {
 		for _, tool := range claudeRequest.Tools {
 			if tool.Name != "" {
 				openaiTools = append(openaiTools, openai.Tool{
@@ -89,9 +67,14 @@ func ConvertClaudeToOpenai(claudeRequest *models.ClaudeMessagesRequest, modelMan
 
 	// Convert tool choice
 	var toolChoice any
-	if claudeRequest.ToolChoice != nil {
+	if claudeRequest.ToolChoice != nil && len(openaiTools) > 0 {
 		if typeVal, ok := claudeRequest.ToolChoice["type"].(string); ok {
-			if typeVal == "tool" {
+			switch typeVal {
+			case "any":
+				toolChoice = "required"
+			case "none":
+				toolChoice = "none"
+			case "tool":
 				nameVal, nameExists := claudeRequest.ToolChoice["name"].(string)
 				if nameExists && nameVal != "" {
 					toolChoice = openai.ToolChoice{
@@ -109,10 +92,8 @@ func ConvertClaudeToOpenai(claudeRequest *models.ClaudeMessagesRequest, modelMan
 		}
 	}
 
-	config := core.GetConfig()
 	openaiRequest := &openai.ChatCompletionRequest{
-		Model:       modelManager.MapClaudeModelToOpenAI(claudeRequest.Model),
-		MaxTokens:   int(math.Min(math.Max(float64(claudeRequest.MaxTokens), float64(config.MinTokensLimit)), float64(config.MaxTokensLimit))),
+		Model:       route.Model,
 		Messages:    convertedMessages,
 		Stop:        claudeRequest.StopSequences,
 		Stream:      claudeRequest.Stream,
@@ -121,6 +102,22 @@ func ConvertClaudeToOpenai(claudeRequest *models.ClaudeMessagesRequest, modelMan
 		Tools:       openaiTools,
 		ToolChoice:  toolChoice,
 	}
+	if profile.MaxTokensParam == core.MAX_COMPLETION_TOKENS_PARAM {
+		openaiRequest.MaxCompletionTokens = ClampMaxTokens(claudeRequest.MaxTokens, route)
+	} else {
+		openaiRequest.MaxTokens = ClampMaxTokens(claudeRequest.MaxTokens, route)
+	}
+	if profile.Drops(core.PARAM_TEMPERATURE) {
+		openaiRequest.Temperature = 0
+	}
+	if profile.Drops(core.PARAM_TOP_P) {
+		openaiRequest.TopP = 0
+	}
+	if profile.Drops(core.PARAM_STOP) {
+		openaiRequest.Stop = nil
+	}
+
+	applyThinking(openaiRequest, claudeRequest.Thinking, route)
 
 	if claudeRequest.Stream {
 		openaiRequest.StreamOptions = &openai.StreamOptions{
@@ -131,104 +128,143 @@ func ConvertClaudeToOpenai(claudeRequest *models.ClaudeMessagesRequest, modelMan
 	return openaiRequest
 }
 
-func convertClaudeUserMessage(msg models.ClaudeMessage) *openai.ChatCompletionMessage {
-	ret := &openai.ChatCompletionMessage{Role: core.ROLE_USER}
-	if msg.Content == nil {
-		return ret
+// ClampMaxTokens keeps max_tokens within the output limits of the route's upstream model.
+func ClampMaxTokens(maxTokens int, route core.Route) int {
+	minTokens, maxTokensLimit := core.GetModelManager().ModelProfile(route.Provider, route.Model).OutputLimits(core.GetConfig())
+	return max(minTokens, min(maxTokens, maxTokensLimit))
+}
+
+// applyThinking maps the Claude thinking setting to the reasoning control of the upstream.
+func applyThinking(openaiRequest *openai.ChatCompletionRequest, thinking models.ClaudeThinkingConfig, route core.Route) {
+	if !thinking.IsEnabled() {
+		return
+	}
+	switch core.ReasoningStyle(route.Provider, route.Model) {
+	case core.REASONING_EFFORT:
+		openaiRequest.ReasoningEffort = core.ReasoningEffortForBudget(thinking.BudgetTokens)
+	case core.REASONING_DEEPSEEK:
+		openaiRequest.ChatTemplateKwargs = map[string]any{"thinking": true}
 	}
+}
 
-	if text, ok := msg.Content.(string); ok {
-		ret.Content = text
-		return ret
+// ExtraRequestFields returns the vendor specific request fields go-openai has no field for.
+func ExtraRequestFields(claudeRequest *models.ClaudeMessagesRequest, route core.Route) map[string]any {
+	if claudeRequest.Thinking.Type == "" {
+		return nil
+	}
+	if core.ReasoningStyle(route.Provider, route.Model) == core.REASONING_DOUBAO {
+		// Ark takes the same {"type": "enabled"|"disabled"} object as Claude
+		return map[string]any{"thinking": map[string]any{"type": claudeRequest.Thinking.Type}}
 	}
+	return nil
+}
+
+// foldSystemPrompt puts the system prompt in front of the first user message, or in a user message
+// of its own when there is none.
+func foldSystemPrompt(messages []openai.ChatCompletionMessage, systemText string) []openai.ChatCompletionMessage {
+	for i, msg := range messages {
+		if msg.Role != core.ROLE_USER {
+			continue
+		}
+		folded := append([]openai.ChatCompletionMessage(nil), messages...)
+		if len(msg.MultiContent) > 0 {
+			part := openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: systemText}
+			folded[i].MultiContent = append([]openai.ChatMessagePart{part}, msg.MultiContent...)
+		} else if msg.Content != "" {
+			folded[i].Content = systemText + "\n\n" + msg.Content
+		} else {
+			folded[i].Content = systemText
+		}
+		return folded
+	}
+	return append([]openai.ChatCompletionMessage{{Role: core.ROLE_USER, Content: systemText}}, messages...)
+}
+
+// convertClaudeUserMessage converts the text and image blocks of a user message to content parts,
+// in their order. It returns nil when the message only carries tool results, which go before it
+// in tool messages.
+func convertClaudeUserMessage(msg models.ClaudeMessage) *openai.ChatCompletionMessage {
+	ret := &openai.ChatCompletionMessage{Role: core.ROLE_USER}
 
 	// Handle multimodal content
-	openaiContent := []map[string]string{}
-	if blocks, ok := msg.Content.([]any); ok {
-		for _, block := range blocks {
-			// 将 block 断言为 map[string]any
-			if blockMap, ok := block.(map[string]any); ok {
-				// 处理文本块
-				if blockType, ok := blockMap["type"].(string); ok && blockType == "text" {
-					if text, ok := blockMap["text"].(string); ok {
-						openaiContent = append(openaiContent, map[string]string{"type": "text", "text": text})
-					}
-				} else if blockType, ok := blockMap["type"].(string); ok && blockType == "image" { // 处理图片块
-					if source, ok := blockMap["source"].(map[string]any); ok {
-						if sourceType, ok := source["type"].(string); ok && sourceType == "base64" {
-							if mediaType, ok := source["media_type"].(string); ok {
-								if data, ok := source["data"].(string); ok {
-									s, _ := json.Marshal(map[string]string{"url": "data:" + mediaType + ";base64," + data})
-									openaiContent = append(openaiContent, map[string]string{
-										"type":      "image_url",
-										"image_url": string(s),
-									})
-								}
-							}
-						}
-					}
-				}
+	openaiContent := []openai.ChatMessagePart{}
+	for _, block := range msg.Content {
+		switch block := block.(type) {
+		case models.ClaudeContentBlockText:
+			openaiContent = append(openaiContent, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: block.Text})
+		case models.ClaudeContentBlockImage:
+			if imageURL := imageSourceURL(block.Source); imageURL != "" {
+				openaiContent = append(openaiContent, openai.ChatMessagePart{
+					Type:     openai.ChatMessagePartTypeImageURL,
+					ImageURL: &openai.ChatMessageImageURL{URL: imageURL},
+				})
 			}
 		}
 	}
 
+	if len(openaiContent) == 0 {
+		if core.HasBlockType(msg.Content, core.CONTENT_TOOL_RESULT) {
+			return nil
+		}
+		return ret
+	}
+
 	// Simplify content if there's only one text block
-	if len(openaiContent) == 1 && openaiContent[0]["type"] == "text" {
-		ret.Content = openaiContent[0]["text"]
+	if len(openaiContent) == 1 && openaiContent[0].Type == openai.ChatMessagePartTypeText {
+		ret.Content = openaiContent[0].Text
 	} else {
-		// Serialize multimodal content into a JSON-like string
-		contentBytes, err := json.Marshal(openaiContent)
-		if err != nil {
-			// ret.Content = "Error serializing content"
-		} else {
-			ret.Content = string(contentBytes)
-		}
+		ret.MultiContent = openaiContent
 	}
 
 	return ret
 }
 
-func convertClaudeAssistantMessage(msg models.ClaudeMessage) *openai.ChatCompletionMessage {
+func convertClaudeAssistantMessage(msg models.ClaudeMessage, route core.Route) *openai.ChatCompletionMessage {
 	textParts := []string{}
+	reasoningParts := []string{}
 	toolCalls := []openai.ToolCall{}
 	ret := &openai.ChatCompletionMessage{
 		Role: core.ROLE_ASSISTANT,
 	}
-	if msg.Content == nil {
-		return ret
-	}
 
-	// if msg.content is a string, convert it to text block
-	if text, ok := msg.Content.(string); ok {
-		ret.Content = text
-		return ret
-	}
-
-	if blocks, ok := msg.Content.([]any); ok {
-		for _, block := range blocks {
-			if text, ok := block.(models.ClaudeContentBlockText); ok {
-				textParts = append(textParts, text.Text)
-			} else if tool, ok := block.(models.ClaudeContentBlockToolUse); ok {
-				strInput, err := json.Marshal(tool.Input)
-				if err != nil {
-					fmt.Printf("Error marshalling tool input: %v\n", err)
-					continue
-				}
-				toolCalls = append(toolCalls, openai.ToolCall{
-					ID:   tool.ID,
-					Type: openai.ToolType(core.TOOL_FUNCTION),
-					Function: openai.FunctionCall{
-						Name:      tool.Name,
-						Arguments: string(strInput),
-					},
-				})
+	for _, block := range msg.Content {
+		switch block := block.(type) {
+		case models.ClaudeContentBlockText:
+			textParts = append(textParts, block.Text)
+		case models.ClaudeContentBlockThinking:
+			// Only reasoning the routed upstream produced is echoed, other upstreams can't use it
+			if state, ok := core.ParseSignature(block.Signature); ok && state.Kind == core.REASONING_STATE_CONTENT && state.Matches(route) {
+				reasoningParts = append(reasoningParts, block.Thinking)
+			}
+		case models.ClaudeContentBlockRedactedThinking:
+			// Redacted thinking only carries encrypted reasoning, which chat completions can't take
+		case models.ClaudeContentBlockToolUse:
+			input := block.Input
+			if input == nil {
+				input = map[string]any{}
+			}
+			strInput, err := json.Marshal(input)
+			if err != nil {
+				fmt.Printf("Error marshalling tool input: %v\n", err)
+				continue
 			}
+			toolCalls = append(toolCalls, openai.ToolCall{
+				ID:   block.ID,
+				Type: openai.ToolType(core.TOOL_FUNCTION),
+				Function: openai.FunctionCall{
+					Name:      block.Name,
+					Arguments: string(strInput),
+				},
+			})
 		}
 	}
 
 	if len(textParts) > 0 {
 		ret.Content = strings.Join(textParts, "")
 	}
+	if len(reasoningParts) > 0 {
+		ret.ReasoningContent = strings.Join(reasoningParts, "")
+	}
 	if len(toolCalls) > 0 {
 		ret.ToolCalls = toolCalls
 	}
@@ -236,69 +272,79 @@ func convertClaudeAssistantMessage(msg models.ClaudeMessage) *openai.ChatComplet
 	return ret
 }
 
-func convertClaudeToolResultMessage(msg models.ClaudeMessage) []openai.ChatCompletionMessage {
-	if msg.Content == nil {
-		return []openai.ChatCompletionMessage{}
-	}
-
+func convertClaudeToolResultMessage(msg models.ClaudeMessage, profile core.ModelProfile) []openai.ChatCompletionMessage {
 	parsedMessages := []openai.ChatCompletionMessage{}
-	if blocks, ok := msg.Content.([]any); ok {
-		for _, block := range blocks {
-			if toolResult, ok := block.(models.ClaudeContentBlockToolResult); ok {
-				parsedMessages = append(parsedMessages, openai.ChatCompletionMessage{
-					Role:       core.ROLE_TOOL,
-					Content:    parseToolResultContent(toolResult.Content),
-					ToolCallID: toolResult.ToolUseID,
-				})
-			}
+	for _, block := range msg.Content {
+		if toolResult, ok := block.(models.ClaudeContentBlockToolResult); ok {
+			parsedMessages = append(parsedMessages, openai.ChatCompletionMessage{
+				Role:       core.ROLE_TOOL,
+				Content:    toolResultOutput(toolResult, profile),
+				ToolCallID: toolResult.ToolUseID,
+			})
 		}
 	}
 	return parsedMessages
 }
 
-func parseToolResultContent(content any) string {
-	if content == nil {
-		return "No content provided"
+// toolResultOutput returns a tool result as the text tool messages take, starting with the error
+// marker of the model when the tool call failed.
+func toolResultOutput(toolResult models.ClaudeContentBlockToolResult, profile core.ModelProfile) string {
+	output := toolResultText(toolResult.Content, profile)
+	if toolResult.IsError {
+		output = profile.ErrorMarker() + "\n" + output
 	}
+	return output
+}
 
-	if text, ok := content.(string); ok {
-		return text
+// toolResultText joins the content of a tool result. Images are left as a note saying where they
+// went, see withToolResultImages.
+func toolResultText(content models.ClaudeContent, profile core.ModelProfile) string {
+	if content == nil {
+		return "No content provided"
 	}
 
-	if contentList, ok := content.([]any); ok {
-		resultParts := []string{}
-		for _, item := range contentList {
-			if block, ok := item.(map[string]any); ok {
-				// if block["type"] == core.CONTENT_TEXT {
-				// 	if text, ok := block["text"].(string); ok {
-				// 		resultParts = append(resultParts, text)
-				// 	}
-				// }
-				if text, ok := block["text"].(string); ok {
-					resultParts = append(resultParts, text)
-				} else if serializedBlock, err := json.Marshal(item); err == nil {
-					resultParts = append(resultParts, string(serializedBlock))
-				} else {
-					resultParts = append(resultParts, fmt.Sprintf("%v", item))
-				}
-			} else if text, ok := item.(string); ok {
-				resultParts = append(resultParts, text)
+	resultParts := []string{}
+	for _, block := range content {
+		if text, ok := core.GetTextField(block); ok {
+			resultParts = append(resultParts, text)
+		} else if _, ok := block.(models.ClaudeContentBlockImage); ok {
+			if profile.ToolResultImageMode() == core.TOOL_RESULT_IMAGES_MESSAGE {
+				resultParts = append(resultParts, "[image: attached to the next user message]")
+			} else {
+				resultParts = append(resultParts, "[image omitted: the model does not accept images]")
 			}
+		} else if serializedBlock, err := json.Marshal(block); err == nil {
+			resultParts = append(resultParts, string(serializedBlock))
+		} else {
+			resultParts = append(resultParts, fmt.Sprintf("%v", block))
 		}
-		return strings.Join(resultParts, "\n")
 	}
+	return strings.Join(resultParts, "\n")
+}
 
-	if contentMap, ok := content.(map[string]any); ok {
-		if contentMap["type"] == core.CONTENT_TEXT {
-			if text, ok := contentMap["text"].(string); ok {
-				return text
+// withToolResultImages returns the content of a user message with each tool result followed by
+// the images it returned, introduced by a text naming the tool call. Tool messages only take
+// text, so the images reach the model as part of the user message instead.
+func withToolResultImages(content models.ClaudeContent, profile core.ModelProfile) models.ClaudeContent {
+	if profile.ToolResultImageMode() != core.TOOL_RESULT_IMAGES_MESSAGE {
+		return content
+	}
+	extended := models.ClaudeContent{}
+	for _, block := range content {
+		extended = append(extended, block)
+		toolResult, ok := block.(models.ClaudeContentBlockToolResult)
+		if !ok || !core.HasBlockType(toolResult.Content, core.CONTENT_IMAGE) {
+			continue
+		}
+		extended = append(extended, models.ClaudeContentBlockText{
+			Type: core.CONTENT_TEXT,
+			Text: fmt.Sprintf("Images returned by tool call %s:", toolResult.ToolUseID),
+		})
+		for _, item := range toolResult.Content {
+			if image, ok := item.(models.ClaudeContentBlockImage); ok {
+				extended = append(extended, image)
 			}
-			return ""
 		}
 	}
-
-	if serialized, err := json.Marshal(content); err == nil {
-		return string(serialized)
-	}
-	return "Unparseable content"
+	return extended
 }
@@ -8,8 +8,18 @@ import (
 	"github.com/sashabaranov/go-openai"
 )
 
+// ThinkingSignature mints the signature of thinking blocks holding the reasoning_content of the
+// routed upstream, so the reasoning can be echoed back to it in later turns.
+func ThinkingSignature(route core.Route) string {
+	state := core.ReasoningState{Kind: core.REASONING_STATE_CONTENT, Model: route.Model}
+	if route.Provider != nil {
+		state.Provider = route.Provider.Name
+	}
+	return core.MintSignature(state)
+}
+
 // Convert OpenAI response to Claude format.
-func ConvertOpeenaiToClaudeResponse(openaiResponse openai.ChatCompletionResponse, originalRequest models.ClaudeMessagesRequest) map[string]any {
+func ConvertOpeenaiToClaudeResponse(openaiResponse openai.ChatCompletionResponse, originalRequest models.ClaudeMessagesRequest, route core.Route) map[string]any {
 	choices := openaiResponse.Choices
 	if len(choices) == 0 {
 		return map[string]any{"error": "No choices in OpenAI response"}
@@ -20,6 +30,15 @@ func ConvertOpeenaiToClaudeResponse(openaiResponse openai.ChatCompletionResponse
 
 	contentBlocks := []map[string]any{}
 
+	// Reasoning comes first, like the thinking block of a Claude response
+	if message.ReasoningContent != "" {
+		contentBlocks = append(contentBlocks, map[string]any{
+			"type":      core.CONTENT_THINKING,
+			"thinking":  message.ReasoningContent,
+			"signature": ThinkingSignature(route),
+		})
+	}
+
 	// Add text content
 	if message.Content != "" {
 		contentBlocks = append(contentBlocks, map[string]any{
@@ -31,12 +50,7 @@ func ConvertOpeenaiToClaudeResponse(openaiResponse openai.ChatCompletionResponse
 	// Add tool calls
 	for _, toolCall := range message.ToolCalls {
 		if toolCall.Type == core.TOOL_FUNCTION {
-			arguments := map[string]any{}
-
-			if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &arguments); err != nil {
-				arguments["raw_input"] = toolCall.Function.Arguments
-			}
-
+			arguments := parseToolArguments(toolCall.Function.Arguments)
 			contentBlocks = append(contentBlocks, map[string]any{
 				"type":  core.CONTENT_TOOL_USE,
 				"id":    toolCall.ID,
@@ -55,13 +69,7 @@ func ConvertOpeenaiToClaudeResponse(openaiResponse openai.ChatCompletionResponse
 	}
 
 	// Map finish reason
-	stopReason := core.STOP_END_TURN // Default value
-	switch choice.FinishReason {
-	case "length":
-		stopReason = core.STOP_MAX_TOKENS
-	case "tool_calls", "function_call":
-		stopReason = core.STOP_TOOL_USE
-	}
+	stopReason := ConvertFinishReason(choice.FinishReason)
 
 	claudeResponse := map[string]any{
 		"id":            openaiResponse.ID,
@@ -79,3 +87,29 @@ func ConvertOpeenaiToClaudeResponse(openaiResponse openai.ChatCompletionResponse
 
 	return claudeResponse
 }
+
+// parseToolArguments decodes the JSON arguments of an upstream tool call into a tool_use input.
+func parseToolArguments(raw string) map[string]any {
+	arguments := map[string]any{}
+	if err := json.Unmarshal([]byte(raw), &arguments); err != nil {
+		// Repair arguments truncated by max_tokens the same way the streaming path does
+		if suffix, ok := core.CompleteJSONObject(raw); ok {
+			arguments = map[string]any{}
+			json.Unmarshal([]byte(raw+suffix), &arguments)
+		} else {
+			arguments["raw_input"] = raw
+		}
+	}
+	return arguments
+}
+
+// ConvertFinishReason maps an OpenAI finish reason to the Claude stop reason.
+func ConvertFinishReason(finishReason openai.FinishReason) string {
+	switch finishReason {
+	case openai.FinishReasonLength:
+		return core.STOP_MAX_TOKENS
+	case openai.FinishReasonToolCalls, openai.FinishReasonFunctionCall:
+		return core.STOP_TOOL_USE
+	}
+	return core.STOP_END_TURN
+}
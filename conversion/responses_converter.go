@@ -0,0 +1,292 @@
+package conversion
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+	"github.com/jiaobendaye/go-claude-code-proxy/models"
+)
+
+// ConvertClaudeToResponses converts a Claude request to an OpenAI Responses API request. The
+// proxy keeps no state, so responses are not stored upstream and reasoning is carried across
+// turns as encrypted content inside thinking signatures.
+func ConvertClaudeToResponses(claudeRequest *models.ClaudeMessagesRequest, route core.Route) *models.ResponsesRequest {
+	responsesRequest := &models.ResponsesRequest{
+		Model:           route.Model,
+		Instructions:    strings.TrimSpace(core.JoinText(claudeRequest.System, "\n\n")),
+		Input:           []models.ResponsesItem{},
+		MaxOutputTokens: ClampMaxTokens(claudeRequest.MaxTokens, route),
+		Stream:          claudeRequest.Stream,
+	}
+
+	profile := core.GetModelManager().ModelProfile(route.Provider, route.Model)
+	for _, msg := range claudeRequest.Messages {
+		if msg.Role == core.ROLE_USER {
+			responsesRequest.Input = append(responsesRequest.Input, convertClaudeUserItems(msg, profile)...)
+		} else if msg.Role == core.ROLE_ASSISTANT {
+			responsesRequest.Input = append(responsesRequest.Input, convertClaudeAssistantItems(msg, route)...)
+		}
+	}
+
+	// Models without tool support don't get tools at all
+	if core.Supports(profile.Tools) {
+		for _, tool := range claudeRequest.Tools {
+			if tool.Name != "" {
+				responsesRequest.Tools = append(responsesRequest.Tools, models.ResponsesTool{
+					Type:        core.TOOL_FUNCTION,
+					Name:        tool.Name,
+					Description: tool.Description,
+					Parameters:  tool.InputSchema,
+				})
+			}
+		}
+	}
+	if claudeRequest.ToolChoice != nil && len(responsesRequest.Tools) > 0 {
+		switch typeVal, _ := claudeRequest.ToolChoice["type"].(string); typeVal {
+		case "any":
+			responsesRequest.ToolChoice = "required"
+		case "none":
+			responsesRequest.ToolChoice = "none"
+		case "tool":
+			if nameVal, _ := claudeRequest.ToolChoice["name"].(string); nameVal != "" {
+				responsesRequest.ToolChoice = map[string]any{"type": core.TOOL_FUNCTION, "name": nameVal}
+			}
+		}
+		if responsesRequest.ToolChoice == nil {
+			responsesRequest.ToolChoice = "auto"
+		}
+	}
+
+	if core.ReasoningStyle(route.Provider, route.Model) == core.REASONING_EFFORT {
+		// Reasoning models reject temperature and top_p, so they are only sent to other models
+		if claudeRequest.Thinking.IsEnabled() {
+			responsesRequest.Reasoning = &models.ResponsesReasoning{
+				Effort:  core.ReasoningEffortForBudget(claudeRequest.Thinking.BudgetTokens),
+				Summary: "auto",
+			}
+			responsesRequest.Include = []string{models.RESPONSES_INCLUDE_ENCRYPTED_REASONING}
+		}
+	} else {
+		if claudeRequest.Temperature != 0 && !profile.Drops(core.PARAM_TEMPERATURE) {
+			responsesRequest.Temperature = &claudeRequest.Temperature
+		}
+		if claudeRequest.TopP != 0 && !profile.Drops(core.PARAM_TOP_P) {
+			responsesRequest.TopP = &claudeRequest.TopP
+		}
+	}
+
+	return responsesRequest
+}
+
+// convertClaudeUserItems converts a user message to function_call_output items for its tool
+// results, followed by a message item for the rest and the images the tools returned.
+func convertClaudeUserItems(msg models.ClaudeMessage, profile core.ModelProfile) []models.ResponsesItem {
+	items := []models.ResponsesItem{}
+	content := []models.ResponsesContent{}
+	for _, block := range withToolResultImages(msg.Content, profile) {
+		switch block := block.(type) {
+		case models.ClaudeContentBlockToolResult:
+			items = append(items, models.ResponsesItem{
+				Type:   models.RESPONSES_ITEM_FUNCTION_CALL_OUTPUT,
+				CallID: block.ToolUseID,
+				Output: toolResultOutput(block, profile),
+			})
+		case models.ClaudeContentBlockText:
+			content = append(content, models.ResponsesContent{Type: models.RESPONSES_CONTENT_INPUT_TEXT, Text: block.Text})
+		case models.ClaudeContentBlockImage:
+			if imageURL := imageSourceURL(block.Source); imageURL != "" {
+				content = append(content, models.ResponsesContent{Type: models.RESPONSES_CONTENT_INPUT_IMAGE, ImageURL: imageURL})
+			}
+		case models.ClaudeContentBlockDocument:
+			// Only PDFs the model reads are left as documents, see ExtractDocuments
+			if isPDF(block.Source) {
+				filename := block.Title
+				if filename == "" {
+					filename = "document.pdf"
+				}
+				content = append(content,
+					models.ResponsesContent{Type: models.RESPONSES_CONTENT_INPUT_TEXT, Text: documentHeader(block)},
+					models.ResponsesContent{Type: models.RESPONSES_CONTENT_INPUT_FILE, Filename: filename, FileData: "data:" + MEDIA_TYPE_PDF + ";base64," + block.Source.Data})
+			}
+		}
+	}
+	if len(content) > 0 {
+		items = append(items, models.ResponsesItem{Type: models.RESPONSES_ITEM_MESSAGE, Role: core.ROLE_USER, Content: content})
+	}
+	return items
+}
+
+// convertClaudeAssistantItems converts an assistant message to output items in block order,
+// restoring the reasoning items the routed upstream produced from their signatures.
+func convertClaudeAssistantItems(msg models.ClaudeMessage, route core.Route) []models.ResponsesItem {
+	items := []models.ResponsesItem{}
+	textParts := []string{}
+	flushText := func() {
+		if len(textParts) > 0 {
+			items = append(items, models.ResponsesItem{
+				Type:    models.RESPONSES_ITEM_MESSAGE,
+				Role:    core.ROLE_ASSISTANT,
+				Content: []models.ResponsesContent{{Type: models.RESPONSES_CONTENT_OUTPUT_TEXT, Text: strings.Join(textParts, "")}},
+			})
+			textParts = textParts[:0]
+		}
+	}
+
+	for _, block := range msg.Content {
+		switch block := block.(type) {
+		case models.ClaudeContentBlockText:
+			textParts = append(textParts, block.Text)
+		case models.ClaudeContentBlockThinking:
+			if item, ok := restoreReasoningItem(block.Signature, block.Thinking, route); ok {
+				flushText()
+				items = append(items, item)
+			}
+		case models.ClaudeContentBlockRedactedThinking:
+			if item, ok := restoreReasoningItem(block.Data, "", route); ok {
+				flushText()
+				items = append(items, item)
+			}
+		case models.ClaudeContentBlockToolUse:
+			flushText()
+			input := block.Input
+			if input == nil {
+				input = map[string]any{}
+			}
+			arguments, _ := json.Marshal(input)
+			items = append(items, models.ResponsesItem{
+				Type:      models.RESPONSES_ITEM_FUNCTION_CALL,
+				CallID:    block.ID,
+				Name:      block.Name,
+				Arguments: string(arguments),
+			})
+		}
+	}
+	flushText()
+	return items
+}
+
+// restoreReasoningItem rebuilds the reasoning item behind a signature minted by ReasoningSignature.
+func restoreReasoningItem(signature, summary string, route core.Route) (models.ResponsesItem, bool) {
+	state, ok := core.ParseSignature(signature)
+	if !ok || state.Kind != core.REASONING_STATE_ENCRYPTED || state.Encrypted == "" || !state.Matches(route) {
+		return models.ResponsesItem{}, false
+	}
+	parts := []models.ResponsesContent{}
+	if summary != "" {
+		parts = append(parts, models.ResponsesContent{Type: models.RESPONSES_CONTENT_SUMMARY_TEXT, Text: summary})
+	}
+	return models.ResponsesItem{
+		Type:             models.RESPONSES_ITEM_REASONING,
+		ID:               state.ItemID,
+		Summary:          &parts,
+		EncryptedContent: state.Encrypted,
+	}, true
+}
+
+// ReasoningSignature mints the signature carrying an encrypted reasoning item of the routed upstream.
+func ReasoningSignature(route core.Route, item models.ResponsesItem) string {
+	state := core.ReasoningState{Kind: core.REASONING_STATE_ENCRYPTED, Model: route.Model, ItemID: item.ID, Encrypted: item.EncryptedContent}
+	if route.Provider != nil {
+		state.Provider = route.Provider.Name
+	}
+	return core.MintSignature(state)
+}
+
+// ReasoningSummary joins the summary parts of a reasoning item.
+func ReasoningSummary(item models.ResponsesItem) string {
+	if item.Summary == nil {
+		return ""
+	}
+	parts := []string{}
+	for _, part := range *item.Summary {
+		parts = append(parts, part.Text)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// ConvertResponsesStopReason maps the outcome of a response to the Claude stop reason.
+func ConvertResponsesStopReason(response *models.ResponsesResponse, calledTools bool) string {
+	if response != nil && response.Status == models.RESPONSES_STATUS_INCOMPLETE &&
+		response.IncompleteDetails != nil && response.IncompleteDetails.Reason == "max_output_tokens" {
+		return core.STOP_MAX_TOKENS
+	}
+	if calledTools {
+		return core.STOP_TOOL_USE
+	}
+	return core.STOP_END_TURN
+}
+
+// ConvertResponsesUsage maps Responses API usage to the Claude usage object.
+func ConvertResponsesUsage(usage *models.ResponsesUsage) map[string]int {
+	if usage == nil {
+		return map[string]int{"input_tokens": 0, "output_tokens": 0}
+	}
+	return map[string]int{
+		"input_tokens":            usage.InputTokens,
+		"output_tokens":           usage.OutputTokens,
+		"cache_read_input_tokens": usage.InputTokensDetails.CachedTokens,
+	}
+}
+
+// ConvertResponsesToClaudeResponse converts a Responses API response to Claude format.
+func ConvertResponsesToClaudeResponse(response models.ResponsesResponse, originalRequest models.ClaudeMessagesRequest, route core.Route) map[string]any {
+	contentBlocks := []map[string]any{}
+	calledTools := false
+
+	for _, item := range response.Output {
+		switch item.Type {
+		case models.RESPONSES_ITEM_REASONING:
+			summary := ReasoningSummary(item)
+			switch {
+			case summary != "":
+				contentBlocks = append(contentBlocks, map[string]any{
+					"type":      core.CONTENT_THINKING,
+					"thinking":  summary,
+					"signature": ReasoningSignature(route, item),
+				})
+			case item.EncryptedContent != "":
+				contentBlocks = append(contentBlocks, map[string]any{
+					"type": core.CONTENT_REDACTED_THINKING,
+					"data": ReasoningSignature(route, item),
+				})
+			}
+		case models.RESPONSES_ITEM_MESSAGE:
+			for _, part := range item.Content {
+				text := part.Text
+				if part.Type == models.RESPONSES_CONTENT_REFUSAL {
+					text = part.Refusal
+				}
+				if text != "" {
+					contentBlocks = append(contentBlocks, map[string]any{"type": core.CONTENT_TEXT, "text": text})
+				}
+			}
+		case models.RESPONSES_ITEM_FUNCTION_CALL:
+			calledTools = true
+			contentBlocks = append(contentBlocks, map[string]any{
+				"type":  core.CONTENT_TOOL_USE,
+				"id":    item.CallID,
+				"name":  item.Name,
+				"input": parseToolArguments(item.Arguments),
+			})
+		}
+	}
+
+	if len(contentBlocks) == 0 {
+		contentBlocks = append(contentBlocks, map[string]any{
+			"type": core.CONTENT_TEXT,
+			"text": "",
+		})
+	}
+
+	return map[string]any{
+		"id":            response.ID,
+		"type":          "message",
+		"role":          "assistant",
+		"model":         originalRequest.Model,
+		"content":       contentBlocks,
+		"stop_reason":   ConvertResponsesStopReason(&response, calledTools),
+		"stop_sequence": nil,
+		"usage":         ConvertResponsesUsage(response.Usage),
+	}
+}
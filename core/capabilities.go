@@ -0,0 +1,401 @@
+package core
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/jiaobendaye/go-claude-code-proxy/models"
+)
+
+// Request parameters a model profile can drop.
+const (
+	PARAM_TEMPERATURE = "temperature"
+	PARAM_TOP_P       = "top_p"
+	PARAM_STOP        = "stop"
+
+	MAX_TOKENS_PARAM            = "max_tokens"
+	MAX_COMPLETION_TOKENS_PARAM = "max_completion_tokens"
+
+	// SYSTEM_ROLE_USER folds the system prompt into the first user message, for models without one
+	SYSTEM_ROLE_USER = "user"
+
+	// TOOL_RESULT_IMAGES_MESSAGE sends the images returned by tools in a user message after the tool results
+	TOOL_RESULT_IMAGES_MESSAGE = "user_message"
+	// TOOL_RESULT_IMAGES_OMIT leaves a note in the tool result in place of its images
+	TOOL_RESULT_IMAGES_OMIT = "omit"
+
+	// DEFAULT_TOOL_ERROR_MARKER starts the output of failed tool calls on upstreams without an error flag
+	DEFAULT_TOOL_ERROR_MARKER = "[ERROR] The tool call failed:"
+
+	// IMAGE_FALLBACK_REJECT fails requests with images, so that route fallbacks can pick a vision model
+	IMAGE_FALLBACK_REJECT = "reject"
+	// IMAGE_FALLBACK_CAPTION replaces images with a description written by the VISION_MODEL
+	IMAGE_FALLBACK_CAPTION = "caption"
+	// IMAGE_FALLBACK_PLACEHOLDER replaces images with a note saying they were left out
+	IMAGE_FALLBACK_PLACEHOLDER = "placeholder"
+
+	// DEFAULT_MAX_IMAGE_EDGE is the longest image side sent, OpenAI scales larger images down to it anyway
+	DEFAULT_MAX_IMAGE_EDGE = 2048
+	// DEFAULT_MAX_IMAGE_BYTES is the largest image sent, the limit of the Anthropic API itself
+	DEFAULT_MAX_IMAGE_BYTES = 5 << 20
+)
+
+// Image media types, in the order models are assumed to take them.
+var (
+	defaultImageFormats = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+	geminiImageFormats  = []string{"image/jpeg", "image/png", "image/webp"}
+	ollamaImageFormats  = []string{"image/jpeg", "image/png"}
+)
+
+// ModelProfile describes what an upstream model supports and how requests must be shaped for it.
+// Unset fields keep the value of the built-in profile; an unset capability is unknown, so
+// requests needing it are still sent.
+type ModelProfile struct {
+	Vision        *bool `json:"vision,omitempty"`
+	Tools         *bool `json:"tools,omitempty"`
+	Thinking      *bool `json:"thinking,omitempty"`
+	ContextWindow int   `json:"context_window,omitempty"`
+	// Documents is reading PDFs sent as files, used with the upstream APIs taking them; other
+	// upstreams get the extracted text
+	Documents *bool `json:"documents,omitempty"`
+	// MinOutputTokens and MaxOutputTokens bound max_tokens, replacing MIN_TOKENS_LIMIT and MAX_TOKENS_LIMIT
+	MinOutputTokens int `json:"min_output_tokens,omitempty"`
+	MaxOutputTokens int `json:"max_output_tokens,omitempty"`
+	// MaxTokensParam names the parameter carrying the output limit: max_tokens or max_completion_tokens
+	MaxTokensParam string `json:"max_tokens_param,omitempty"`
+	// SystemRole is the role the system prompt is sent with: system, developer, or user to put it
+	// in front of the first user message
+	SystemRole string `json:"system_role,omitempty"`
+	// DropParams lists the sampling parameters the model rejects: temperature, top_p, stop
+	DropParams []string `json:"drop_params,omitempty"`
+	// ContextOverflow replaces the CONTEXT_OVERFLOW strategies for the model
+	ContextOverflow []string `json:"context_overflow,omitempty"`
+	// ToolResultImages is how images returned by tools reach the model: user_message or omit. Models
+	// that may take images get them in a user message by default.
+	ToolResultImages string `json:"tool_result_images,omitempty"`
+	// ToolErrorMarker replaces DEFAULT_TOOL_ERROR_MARKER for the model
+	ToolErrorMarker string `json:"tool_error_marker,omitempty"`
+	// ImageFallback is what becomes of images sent to a model without vision: reject, caption or
+	// placeholder. They are captioned by default when VISION_MODEL is set, rejected otherwise.
+	ImageFallback string `json:"image_fallback,omitempty"`
+	// MaxImageEdge and MaxImagePixels bound the size images are scaled down to, replacing
+	// DEFAULT_MAX_IMAGE_EDGE; there is no pixel budget by default
+	MaxImageEdge   int `json:"max_image_edge,omitempty"`
+	MaxImagePixels int `json:"max_image_pixels,omitempty"`
+	// MaxImageBytes replaces DEFAULT_MAX_IMAGE_BYTES, larger images are re-encoded to fit
+	MaxImageBytes int `json:"max_image_bytes,omitempty"`
+	// ImageFormats lists the image media types the model takes, others are converted to JPEG or PNG
+	ImageFormats []string `json:"image_formats,omitempty"`
+}
+
+// ImageLimits bounds the images sent to a model.
+type ImageLimits struct {
+	MaxEdge   int
+	MaxPixels int
+	MaxBytes  int
+	Formats   []string
+}
+
+func (p ModelProfile) validate() error {
+	if p.MinOutputTokens < 0 || p.MaxOutputTokens < 0 || p.ContextWindow < 0 {
+		return fmt.Errorf("token limits must not be negative")
+	}
+	if p.MaxOutputTokens != 0 && p.MinOutputTokens > p.MaxOutputTokens {
+		return fmt.Errorf("min_output_tokens %d exceeds max_output_tokens %d", p.MinOutputTokens, p.MaxOutputTokens)
+	}
+	switch p.MaxTokensParam {
+	case "", MAX_TOKENS_PARAM, MAX_COMPLETION_TOKENS_PARAM:
+	default:
+		return fmt.Errorf("unknown max_tokens_param %q", p.MaxTokensParam)
+	}
+	switch p.SystemRole {
+	case "", ROLE_SYSTEM, ROLE_DEVELOPER, SYSTEM_ROLE_USER:
+	default:
+		return fmt.Errorf("unknown system_role %q", p.SystemRole)
+	}
+	switch p.ToolResultImages {
+	case "", TOOL_RESULT_IMAGES_MESSAGE, TOOL_RESULT_IMAGES_OMIT:
+	default:
+		return fmt.Errorf("unknown tool_result_images %q", p.ToolResultImages)
+	}
+	switch p.ImageFallback {
+	case "", IMAGE_FALLBACK_REJECT, IMAGE_FALLBACK_CAPTION, IMAGE_FALLBACK_PLACEHOLDER:
+	default:
+		return fmt.Errorf("unknown image_fallback %q", p.ImageFallback)
+	}
+	for _, strategy := range p.ContextOverflow {
+		if err := validateOverflowStrategy(strategy); err != nil {
+			return err
+		}
+	}
+	for _, param := range p.DropParams {
+		switch param {
+		case PARAM_TEMPERATURE, PARAM_TOP_P, PARAM_STOP:
+		default:
+			return fmt.Errorf("unknown drop_params entry %q", param)
+		}
+	}
+	if p.MaxImageEdge < 0 || p.MaxImagePixels < 0 || p.MaxImageBytes < 0 {
+		return fmt.Errorf("image limits must not be negative")
+	}
+	if p.ImageFormats != nil {
+		for _, format := range p.ImageFormats {
+			if !slices.Contains(defaultImageFormats, format) {
+				return fmt.Errorf("unknown image_formats entry %q", format)
+			}
+		}
+		// Images are converted to one of these
+		if !slices.Contains(p.ImageFormats, "image/jpeg") && !slices.Contains(p.ImageFormats, "image/png") {
+			return fmt.Errorf("image_formats must include image/jpeg or image/png")
+		}
+	}
+	return nil
+}
+
+// merge returns the profile with the fields set in override replaced.
+func (p ModelProfile) merge(override ModelProfile) ModelProfile {
+	if override.Vision != nil {
+		p.Vision = override.Vision
+	}
+	if override.Tools != nil {
+		p.Tools = override.Tools
+	}
+	if override.Thinking != nil {
+		p.Thinking = override.Thinking
+	}
+	if override.Documents != nil {
+		p.Documents = override.Documents
+	}
+	if override.ContextWindow != 0 {
+		p.ContextWindow = override.ContextWindow
+	}
+	if override.MinOutputTokens != 0 {
+		p.MinOutputTokens = override.MinOutputTokens
+	}
+	if override.MaxOutputTokens != 0 {
+		p.MaxOutputTokens = override.MaxOutputTokens
+	}
+	if override.MaxTokensParam != "" {
+		p.MaxTokensParam = override.MaxTokensParam
+	}
+	if override.SystemRole != "" {
+		p.SystemRole = override.SystemRole
+	}
+	if override.DropParams != nil {
+		p.DropParams = override.DropParams
+	}
+	if override.ContextOverflow != nil {
+		p.ContextOverflow = override.ContextOverflow
+	}
+	if override.ToolResultImages != "" {
+		p.ToolResultImages = override.ToolResultImages
+	}
+	if override.ToolErrorMarker != "" {
+		p.ToolErrorMarker = override.ToolErrorMarker
+	}
+	if override.ImageFallback != "" {
+		p.ImageFallback = override.ImageFallback
+	}
+	if override.MaxImageEdge != 0 {
+		p.MaxImageEdge = override.MaxImageEdge
+	}
+	if override.MaxImagePixels != 0 {
+		p.MaxImagePixels = override.MaxImagePixels
+	}
+	if override.MaxImageBytes != 0 {
+		p.MaxImageBytes = override.MaxImageBytes
+	}
+	if override.ImageFormats != nil {
+		p.ImageFormats = override.ImageFormats
+	}
+	return p
+}
+
+// Drops reports whether the model rejects a request parameter.
+func (p ModelProfile) Drops(param string) bool {
+	for _, dropped := range p.DropParams {
+		if dropped == param {
+			return true
+		}
+	}
+	return false
+}
+
+// OutputLimits returns the bounds of max_tokens: the profile's, or MIN_TOKENS_LIMIT and
+// MAX_TOKENS_LIMIT where it sets none.
+func (p ModelProfile) OutputLimits(config *Config) (int, int) {
+	minTokens, maxTokens := config.MinTokensLimit, config.MaxTokensLimit
+	if p.MinOutputTokens > 0 {
+		minTokens = p.MinOutputTokens
+	}
+	if p.MaxOutputTokens > 0 {
+		maxTokens = p.MaxOutputTokens
+	}
+	return min(minTokens, maxTokens), maxTokens
+}
+
+// ToolResultImageMode returns how images returned by tools are sent, see TOOL_RESULT_IMAGES_*.
+func (p ModelProfile) ToolResultImageMode() string {
+	if p.ToolResultImages != "" {
+		return p.ToolResultImages
+	}
+	if Supports(p.Vision) {
+		return TOOL_RESULT_IMAGES_MESSAGE
+	}
+	return TOOL_RESULT_IMAGES_OMIT
+}
+
+// ErrorMarker returns the text starting the output of failed tool calls.
+func (p ModelProfile) ErrorMarker() string {
+	if p.ToolErrorMarker != "" {
+		return p.ToolErrorMarker
+	}
+	return DEFAULT_TOOL_ERROR_MARKER
+}
+
+// ImageFallbackMode returns what becomes of images sent to the model, see IMAGE_FALLBACK_*, or ""
+// when it may take them.
+func (p ModelProfile) ImageFallbackMode(config *Config) string {
+	if Supports(p.Vision) {
+		return ""
+	}
+	if p.ImageFallback != "" {
+		return p.ImageFallback
+	}
+	if config.VisionModel != "" {
+		return IMAGE_FALLBACK_CAPTION
+	}
+	return IMAGE_FALLBACK_REJECT
+}
+
+// ImageLimits returns the limits of the images sent to the model, the defaults where the profile
+// sets none.
+func (p ModelProfile) ImageLimits() ImageLimits {
+	limits := ImageLimits{MaxEdge: DEFAULT_MAX_IMAGE_EDGE, MaxPixels: p.MaxImagePixels, MaxBytes: DEFAULT_MAX_IMAGE_BYTES, Formats: defaultImageFormats}
+	if p.MaxImageEdge > 0 {
+		limits.MaxEdge = p.MaxImageEdge
+	}
+	if p.MaxImageBytes > 0 {
+		limits.MaxBytes = p.MaxImageBytes
+	}
+	if p.ImageFormats != nil {
+		limits.Formats = p.ImageFormats
+	}
+	return limits
+}
+
+// Supports reports whether a capability is not known to be missing.
+func Supports(capability *bool) bool {
+	return capability == nil || *capability
+}
+
+// Capabilities returns the capabilities as listed by /v1/models, unknown ones reported as missing
+// except for tools.
+func (p ModelProfile) Capabilities() models.ClaudeModelCapabilities {
+	return models.ClaudeModelCapabilities{
+		Vision:        p.Vision != nil && *p.Vision,
+		Tools:         Supports(p.Tools),
+		Thinking:      p.Thinking != nil && *p.Thinking,
+		Documents:     p.Documents != nil && *p.Documents,
+		ContextWindow: p.ContextWindow,
+	}
+}
+
+var (
+	yes = func() *bool { b := true; return &b }()
+	no  = func() *bool { b := false; return &b }()
+)
+
+// reasoningModelParams are the sampling parameters OpenAI reasoning models reject.
+var reasoningModelParams = []string{PARAM_TEMPERATURE, PARAM_TOP_P, PARAM_STOP}
+
+// builtinProfiles describes well known upstream model families, matched in order against the
+// lower case model name without any vendor prefix like "openai/".
+var builtinProfiles = []struct {
+	match   string
+	profile ModelProfile
+}{
+	{"o1-mini*", ModelProfile{Vision: no, Tools: no, Thinking: yes, ContextWindow: 128000, MaxOutputTokens: 65536,
+		MaxTokensParam: MAX_COMPLETION_TOKENS_PARAM, SystemRole: SYSTEM_ROLE_USER, DropParams: reasoningModelParams}},
+	{"o1-preview*", ModelProfile{Vision: no, Tools: no, Thinking: yes, ContextWindow: 128000, MaxOutputTokens: 32768,
+		MaxTokensParam: MAX_COMPLETION_TOKENS_PARAM, SystemRole: SYSTEM_ROLE_USER, DropParams: reasoningModelParams}},
+	{"o3-mini*", ModelProfile{Vision: no, Tools: yes, Thinking: yes, ContextWindow: 200000, MaxOutputTokens: 100000,
+		MaxTokensParam: MAX_COMPLETION_TOKENS_PARAM, DropParams: reasoningModelParams}},
+	{"o[134]*", ModelProfile{Vision: yes, Tools: yes, Thinking: yes, Documents: yes, ContextWindow: 200000, MaxOutputTokens: 100000,
+		MaxTokensParam: MAX_COMPLETION_TOKENS_PARAM, DropParams: reasoningModelParams}},
+	{"gpt-5-chat*", ModelProfile{Vision: yes, Tools: yes, Thinking: no, ContextWindow: 128000, MaxOutputTokens: 16384,
+		MaxTokensParam: MAX_COMPLETION_TOKENS_PARAM}},
+	{"gpt-5*", ModelProfile{Vision: yes, Tools: yes, Thinking: yes, Documents: yes, ContextWindow: 400000, MaxOutputTokens: 128000,
+		MaxTokensParam: MAX_COMPLETION_TOKENS_PARAM, DropParams: reasoningModelParams}},
+	{"gpt-4.1*", ModelProfile{Vision: yes, Tools: yes, Documents: yes, ContextWindow: 1047576, MaxOutputTokens: 32768}},
+	{"gpt-4o*", ModelProfile{Vision: yes, Tools: yes, Documents: yes, ContextWindow: 128000, MaxOutputTokens: 16384}},
+	{"gpt-oss*", ModelProfile{Vision: no, Tools: yes, Thinking: yes, ContextWindow: 131072, MaxOutputTokens: 131072}},
+	{"gpt-3.5*", ModelProfile{Vision: no, Tools: yes, ContextWindow: 16385, MaxOutputTokens: 4096}},
+	// Claude scales images beyond 1568px or about 1.15 megapixels down itself
+	{"claude-3-*", ModelProfile{Vision: yes, Tools: yes, Thinking: no, Documents: yes, ContextWindow: 200000, MaxOutputTokens: 8192,
+		MaxImageEdge: 1568, MaxImagePixels: 1150000}},
+	{"claude-*", ModelProfile{Vision: yes, Tools: yes, Thinking: yes, Documents: yes, ContextWindow: 200000, MaxOutputTokens: 64000,
+		MaxImageEdge: 1568, MaxImagePixels: 1150000}},
+	{"gemini-2.5*", ModelProfile{Vision: yes, Tools: yes, Thinking: yes, Documents: yes, ContextWindow: 1048576, MaxOutputTokens: 65536,
+		ImageFormats: geminiImageFormats}},
+	{"gemini-*", ModelProfile{Vision: yes, Tools: yes, Documents: yes, ContextWindow: 1048576, MaxOutputTokens: 8192,
+		ImageFormats: geminiImageFormats}},
+	{"deepseek-reasoner*", ModelProfile{Vision: no, Tools: yes, Thinking: yes, ContextWindow: 128000, MaxOutputTokens: 65536}},
+	{"deepseek-*", ModelProfile{Vision: no, Tools: yes, ContextWindow: 128000, MaxOutputTokens: 8192}},
+	{"doubao-seed-*", ModelProfile{Vision: yes, Tools: yes, Thinking: yes, ContextWindow: 256000, MaxOutputTokens: 32768}},
+	{"qwen3*", ModelProfile{Tools: yes, Thinking: yes}},
+	{"llama3.[123]*", ModelProfile{Tools: yes, ContextWindow: 131072}},
+	{"llava*", ModelProfile{Vision: yes}},
+}
+
+// builtinProfile returns the built-in profile of a model, empty for unknown models.
+func builtinProfile(model string) ModelProfile {
+	name := strings.ToLower(model)
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	for _, builtin := range builtinProfiles {
+		if ok, _ := path.Match(builtin.match, name); ok {
+			return builtin.profile
+		}
+	}
+	return ModelProfile{}
+}
+
+// ModelProfile returns the profile of an upstream model on a provider: the built-in profile,
+// adjusted to the provider's settings, with the models section of the routing file on top.
+func (m *ModelManager) ModelProfile(provider *ProviderConfig, model string) ModelProfile {
+	profile := builtinProfile(model)
+	if provider != nil {
+		switch provider.Type {
+		case PROVIDER_OLLAMA:
+			// The context window is whatever the provider asks Ollama to allocate
+			options := provider.OllamaOptions(model)
+			if options.NumCtx > 0 {
+				profile.ContextWindow = options.NumCtx
+			}
+			if options.Think == false {
+				profile.Thinking = no
+			}
+			if profile.ImageFormats == nil {
+				profile.ImageFormats = ollamaImageFormats
+			}
+		case PROVIDER_OPENAI, PROVIDER_AZURE:
+			// Thinking depends on how the provider is asked for it
+			if provider.Reasoning != "" {
+				profile.Thinking = no
+				if provider.Reasoning != REASONING_NONE {
+					profile.Thinking = yes
+				}
+			} else if ReasoningStyle(provider, model) != REASONING_NONE {
+				profile.Thinking = yes
+			}
+		}
+	}
+	if override, ok := lookupPattern(m.Routing.Models, model); ok {
+		profile = profile.merge(override)
+	}
+	return profile
+}
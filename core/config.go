@@ -12,16 +12,34 @@ type Config struct {
 	AnthropicAPIKey string
 	OpenAIBaseURL   string
 	AzureAPIVersion string
-	Host            string
-	Port            int
-	LogLevel        string
-	MaxTokensLimit  int
-	MinTokensLimit  int
-	RequestTimeout  int
-	MaxRetries      int
-	BigModel        string
-	MiddleModel     string
-	SmallModel      string
+	// Azure deployment names serving the big/middle/small models, only used when AzureAPIVersion is set.
+	AzureBigDeployment    string
+	AzureMiddleDeployment string
+	AzureSmallDeployment  string
+	Host                  string
+	Port                  int
+	LogLevel              string
+	MaxTokensLimit        int
+	MinTokensLimit        int
+	RequestTimeout        int
+	MaxRetries            int
+	RetryDeadline         int
+	BigModel              string
+	MiddleModel           string
+	SmallModel            string
+	RoutesConfig          string
+	// ThinkingStoreDir keeps reasoning payloads too large to embed in a thinking signature.
+	ThinkingStoreDir string
+	// ThinkingStoreMaxAgeDays is how long a stored payload is kept after it was last written or
+	// read; older files are deleted while new ones are written. 0 keeps them forever.
+	ThinkingStoreMaxAgeDays int
+	// ContextOverflow lists the strategies applied to prompts exceeding the context window, see OVERFLOW_*.
+	ContextOverflow []string
+	// VisionModel describes images for models without vision, routed like the client's models.
+	VisionModel string
+	// FetchPrivateURLs lets image and document URLs point at loopback, private and link-local
+	// addresses, which are refused so that clients can't reach the proxy's own network.
+	FetchPrivateURLs bool
 }
 
 var (
@@ -37,8 +55,9 @@ func GetConfig() *Config {
 }
 
 func NewConfig() *Config {
+	routesConfig := os.Getenv("ROUTES_CONFIG")
 	openaiAPIKey := os.Getenv("OPENAI_API_KEY")
-	if openaiAPIKey == "" {
+	if openaiAPIKey == "" && routesConfig == "" {
 		log.Fatalf("OPENAI_API_KEY not found in environment variables")
 	}
 
@@ -47,21 +66,42 @@ func NewConfig() *Config {
 		log.Println("Warning: ANTHROPIC_API_KEY not set. Client API key validation will be disabled.")
 	}
 
+	bigModel := getEnvOrDefault("BIG_MODEL", "gpt-4o")
+	middleModel := getEnvOrDefault("MIDDLE_MODEL", bigModel)
+	smallModel := getEnvOrDefault("SMALL_MODEL", "gpt-4o-mini")
+
+	contextOverflow, err := ParseOverflowStrategies(os.Getenv("CONTEXT_OVERFLOW"))
+	if err != nil {
+		log.Fatalf("CONTEXT_OVERFLOW: %v", err)
+	}
+
 	return &Config{
 		OpenAIAPIKey:    openaiAPIKey,
 		AnthropicAPIKey: anthropicAPIKey,
 		OpenAIBaseURL:   getEnvOrDefault("OPENAI_BASE_URL", "https://api.openai.com/v1"),
 		AzureAPIVersion: os.Getenv("AZURE_API_VERSION"),
-		Host:            getEnvOrDefault("HOST", "0.0.0.0"),
-		Port:            getEnvAsIntOrDefault("PORT", 8082),
-		LogLevel:        getEnvOrDefault("LOG_LEVEL", "INFO"),
-		MaxTokensLimit:  getEnvAsIntOrDefault("MAX_TOKENS_LIMIT", 4096),
-		MinTokensLimit:  getEnvAsIntOrDefault("MIN_TOKENS_LIMIT", 100),
-		RequestTimeout:  getEnvAsIntOrDefault("REQUEST_TIMEOUT", 90),
-		MaxRetries:      getEnvAsIntOrDefault("MAX_RETRIES", 2),
-		BigModel:        getEnvOrDefault("BIG_MODEL", "gpt-4o"),
-		MiddleModel:     getEnvOrDefault("MIDDLE_MODEL", getEnvOrDefault("BIG_MODEL", "gpt-4o")),
-		SmallModel:      getEnvOrDefault("SMALL_MODEL", "gpt-4o-mini"),
+		// Deployment names default to the model names, like the Azure portal suggests.
+		AzureBigDeployment:    getEnvOrDefault("AZURE_BIG_DEPLOYMENT", bigModel),
+		AzureMiddleDeployment: getEnvOrDefault("AZURE_MIDDLE_DEPLOYMENT", middleModel),
+		AzureSmallDeployment:  getEnvOrDefault("AZURE_SMALL_DEPLOYMENT", smallModel),
+		Host:                  getEnvOrDefault("HOST", "0.0.0.0"),
+		Port:                  getEnvAsIntOrDefault("PORT", 8082),
+		LogLevel:              getEnvOrDefault("LOG_LEVEL", "INFO"),
+		MaxTokensLimit:        getEnvAsIntOrDefault("MAX_TOKENS_LIMIT", 4096),
+		MinTokensLimit:        getEnvAsIntOrDefault("MIN_TOKENS_LIMIT", 100),
+		RequestTimeout:        getEnvAsIntOrDefault("REQUEST_TIMEOUT", 90),
+		MaxRetries:            getEnvAsIntOrDefault("MAX_RETRIES", 2),
+		RetryDeadline:         getEnvAsIntOrDefault("RETRY_DEADLINE", 300),
+		BigModel:              bigModel,
+		MiddleModel:           middleModel,
+		SmallModel:            smallModel,
+		RoutesConfig:          routesConfig,
+		ThinkingStoreDir:      os.Getenv("THINKING_STORE_DIR"),
+		ContextOverflow:       contextOverflow,
+		VisionModel:           os.Getenv("VISION_MODEL"),
+		FetchPrivateURLs:      getEnvAsBoolOrDefault("FETCH_PRIVATE_URLS", false),
+		// Stored reasoning states are kept for a month after their last use
+		ThinkingStoreMaxAgeDays: getEnvAsIntOrDefault("THINKING_STORE_MAX_AGE_DAYS", 30),
 	}
 }
 
@@ -83,10 +123,29 @@ func getEnvAsIntOrDefault(envKey string, defaultValue int) int {
 
 }
 
+func getEnvAsBoolOrDefault(envKey string, defaultValue bool) bool {
+	if value := os.Getenv(envKey); value != "" {
+		boolVal, err := strconv.ParseBool(value)
+		if err == nil {
+			return boolVal
+		}
+	}
+	return defaultValue
+}
+
+// IsAzure reports whether the upstream is an Azure OpenAI resource.
+func (c *Config) IsAzure() bool {
+	return c.AzureAPIVersion != ""
+}
+
 func (c *Config) ValidateAPIKey() bool {
 	if c.OpenAIAPIKey == "" {
 		return false
 	}
+	// Azure keys are plain hex strings without a prefix
+	if c.IsAzure() {
+		return true
+	}
 	// Basic format check for OpenAI API keys
 	if len(c.OpenAIAPIKey) < 3 || (c.OpenAIAPIKey[:3] != "sk-" && c.OpenAIAPIKey[:3] != "SK-") {
 		return false
@@ -107,6 +166,11 @@ func (c *Config) Dump() {
 	log.Printf("AnthropicAPIKey: %s", c.AnthropicAPIKey)
 	log.Printf("OpenAIBaseURL: %s", c.OpenAIBaseURL)
 	log.Printf("AzureAPIVersion: %s", c.AzureAPIVersion)
+	if c.IsAzure() {
+		log.Printf("AzureBigDeployment: %s", c.AzureBigDeployment)
+		log.Printf("AzureMiddleDeployment: %s", c.AzureMiddleDeployment)
+		log.Printf("AzureSmallDeployment: %s", c.AzureSmallDeployment)
+	}
 	log.Printf("Host: %s", c.Host)
 	log.Printf("Port: %d", c.Port)
 	log.Printf("LogLevel: %s", c.LogLevel)
@@ -114,7 +178,14 @@ func (c *Config) Dump() {
 	log.Printf("MinTokensLimit: %d", c.MinTokensLimit)
 	log.Printf("RequestTimeout: %d", c.RequestTimeout)
 	log.Printf("MaxRetries: %d", c.MaxRetries)
+	log.Printf("RetryDeadline: %d", c.RetryDeadline)
 	log.Printf("BigModel: %s", c.BigModel)
 	log.Printf("MiddleModel: %s", c.MiddleModel)
 	log.Printf("SmallModel: %s", c.SmallModel)
+	log.Printf("RoutesConfig: %s", c.RoutesConfig)
+	log.Printf("ThinkingStoreDir: %s", c.ThinkingStoreDir)
+	log.Printf("ThinkingStoreMaxAgeDays: %d", c.ThinkingStoreMaxAgeDays)
+	log.Printf("ContextOverflow: %v", c.ContextOverflow)
+	log.Printf("VisionModel: %s", c.VisionModel)
+	log.Printf("FetchPrivateURLs: %t", c.FetchPrivateURLs)
 }
@@ -4,18 +4,30 @@ const (
 	ROLE_USER      = "user"
 	ROLE_ASSISTANT = "assistant"
 	ROLE_SYSTEM    = "system"
+	ROLE_DEVELOPER = "developer"
 	ROLE_TOOL      = "tool"
 
-	CONTENT_TEXT        = "text"
-	CONTENT_IMAGE       = "image"
-	CONTENT_TOOL_USE    = "tool_use"
-	CONTENT_TOOL_RESULT = "tool_result"
+	CONTENT_TEXT              = "text"
+	CONTENT_IMAGE             = "image"
+	CONTENT_DOCUMENT          = "document"
+	CONTENT_TOOL_USE          = "tool_use"
+	CONTENT_TOOL_RESULT       = "tool_result"
+	CONTENT_THINKING          = "thinking"
+	CONTENT_REDACTED_THINKING = "redacted_thinking"
+
+	SOURCE_BASE64 = "base64"
+	SOURCE_URL    = "url"
+	SOURCE_FILE   = "file"
+	// Sources of documents only
+	SOURCE_TEXT    = "text"
+	SOURCE_CONTENT = "content"
 
 	TOOL_FUNCTION = "function"
 
 	STOP_END_TURN   = "end_turn"
 	STOP_MAX_TOKENS = "max_tokens"
 	STOP_TOOL_USE   = "tool_use"
+	STOP_REFUSAL    = "refusal"
 	STOP_ERROR      = "error"
 
 	EVENT_MESSAGE_START       = "message_start"
@@ -28,4 +40,6 @@ const (
 
 	DELTA_TEXT       = "text_delta"
 	DELTA_INPUT_JSON = "input_json_delta"
+	DELTA_THINKING   = "thinking_delta"
+	DELTA_SIGNATURE  = "signature_delta"
 )
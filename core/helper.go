@@ -1,37 +1,48 @@
 package core
 
-import "reflect"
+import (
+	"strings"
 
-func GetField(value any, fieldName string) (string, bool) {
-	v := reflect.ValueOf(value)
-	if v.Kind() == reflect.Pointer {
-		v = v.Elem()
-	}
-	if v.Kind() == reflect.Struct {
-		field := v.FieldByName(fieldName)
-		if field.IsValid() && field.CanInterface() {
-			if text, ok := field.Interface().(string); ok {
-				return text, true
-			}
-		}
+	"github.com/jiaobendaye/go-claude-code-proxy/models"
+)
+
+// GetTextField returns the text of a text block.
+func GetTextField(block models.ClaudeContentBlock) (string, bool) {
+	if text, ok := block.(models.ClaudeContentBlockText); ok {
+		return text.Text, true
 	}
 	return "", false
 }
 
-func GetTextField(value any) (string, bool) {
-	return GetField(value, "text")
+// HasBlockType reports whether content contains a block of the given type.
+func HasBlockType(content models.ClaudeContent, blockType string) bool {
+	for _, block := range content {
+		if block.BlockType() == blockType {
+			return true
+		}
+	}
+	return false
 }
 
-func HasField(value any, fieldName string) bool {
-	v := reflect.ValueOf(value)
-	if v.Kind() == reflect.Pointer {
-		v = v.Elem()
+// JoinText concatenates the text blocks of content with sep, ignoring other block types.
+func JoinText(content models.ClaudeContent, sep string) string {
+	textParts := []string{}
+	for _, block := range content {
+		if text, ok := GetTextField(block); ok {
+			textParts = append(textParts, text)
+		}
 	}
-	if v.Kind() == reflect.Struct {
-		field := v.FieldByName(fieldName)
-		if field.IsValid() && field.CanInterface() {
-			return true
+	return strings.Join(textParts, sep)
+}
+
+// TokenCounts keeps the token counts of a decoded Claude usage object, which also holds nested
+// objects like server_tool_use.
+func TokenCounts(usage map[string]any) map[string]int {
+	counts := map[string]int{}
+	for key, value := range usage {
+		if count, ok := value.(float64); ok {
+			counts[key] = int(count)
 		}
 	}
-	return false
+	return counts
 }
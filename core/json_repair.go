@@ -0,0 +1,222 @@
+package core
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// JSON container states while scanning a truncated document.
+const (
+	jsonExpectKey = iota
+	jsonExpectColon
+	jsonExpectValue
+	jsonAfterValue
+)
+
+type jsonFrame struct {
+	closer byte
+	state  int
+	// afterComma is set when the frame expects a key or value because of a trailing comma
+	afterComma bool
+}
+
+// CompleteJSONObject returns the suffix that turns a truncated JSON object into a valid one,
+// for tool arguments cut off by max_tokens or a broken upstream. Since streamed fragments can't
+// be taken back, the repair only appends: it closes strings, finishes literals and numbers,
+// supplies null for a missing value and closes open containers. It fails when the text is not
+// a prefix of a JSON object, or would need content removed (like a trailing comma).
+func CompleteJSONObject(prefix string) (string, bool) {
+	trimmed := strings.TrimSpace(prefix)
+	if trimmed == "" {
+		return "{}", true
+	}
+	if trimmed[0] != '{' {
+		return "", false
+	}
+
+	var stack []jsonFrame
+	inString, escaped, unicodeDigits := false, false, -1
+	literal := ""
+	number := ""
+	stringIsKey := false
+
+	valueDone := func() {
+		if len(stack) > 0 {
+			stack[len(stack)-1].state = jsonAfterValue
+			stack[len(stack)-1].afterComma = false
+		}
+	}
+
+	for i := 0; i < len(prefix); i++ {
+		ch := prefix[i]
+		if inString {
+			switch {
+			case unicodeDigits >= 0:
+				if !strings.ContainsRune("0123456789abcdefABCDEF", rune(ch)) {
+					return "", false
+				}
+				unicodeDigits++
+				if unicodeDigits == 4 {
+					unicodeDigits = -1
+				}
+			case escaped:
+				escaped = false
+				if ch == 'u' {
+					unicodeDigits = 0
+				}
+			case ch == '\\':
+				escaped = true
+			case ch == '"':
+				inString = false
+				if stringIsKey {
+					stack[len(stack)-1].state = jsonExpectColon
+				} else {
+					valueDone()
+				}
+			}
+			continue
+		}
+
+		if literal != "" || number != "" {
+			if literal != "" && ch >= 'a' && ch <= 'z' {
+				literal += string(ch)
+				continue
+			}
+			if number != "" && strings.ContainsRune("0123456789+-.eE", rune(ch)) {
+				number += string(ch)
+				continue
+			}
+			if literal != "" && literal != "true" && literal != "false" && literal != "null" {
+				return "", false
+			}
+			literal, number = "", ""
+			valueDone()
+		}
+
+		if ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' {
+			continue
+		}
+		if len(stack) == 0 && i > 0 {
+			// Content after the top-level object
+			return "", false
+		}
+
+		var top *jsonFrame
+		if len(stack) > 0 {
+			top = &stack[len(stack)-1]
+			if ch != ',' && ch != '}' && ch != ']' {
+				top.afterComma = false
+			}
+		}
+		switch {
+		case ch == '{' || ch == '[':
+			if top != nil && top.state != jsonExpectValue {
+				return "", false
+			}
+			frame := jsonFrame{closer: '}', state: jsonExpectKey}
+			if ch == '[' {
+				frame = jsonFrame{closer: ']', state: jsonExpectValue}
+			}
+			stack = append(stack, frame)
+		case ch == '}' || ch == ']':
+			if top == nil || top.closer != ch || top.afterComma {
+				return "", false
+			}
+			if top.state != jsonAfterValue && !(ch == '}' && top.state == jsonExpectKey) && !(ch == ']' && top.state == jsonExpectValue) {
+				return "", false
+			}
+			stack = stack[:len(stack)-1]
+			valueDone()
+		case ch == '"':
+			if top == nil {
+				return "", false
+			}
+			if top.closer == '}' && top.state == jsonExpectKey {
+				stringIsKey = true
+			} else if top.state == jsonExpectValue {
+				stringIsKey = false
+			} else {
+				return "", false
+			}
+			inString = true
+		case ch == ':':
+			if top == nil || top.state != jsonExpectColon {
+				return "", false
+			}
+			top.state = jsonExpectValue
+		case ch == ',':
+			if top == nil || top.state != jsonAfterValue {
+				return "", false
+			}
+			top.state = jsonExpectValue
+			if top.closer == '}' {
+				top.state = jsonExpectKey
+			}
+			top.afterComma = true
+		case ch == 't' || ch == 'f' || ch == 'n':
+			if top == nil || top.state != jsonExpectValue {
+				return "", false
+			}
+			literal = string(ch)
+		case ch == '-' || (ch >= '0' && ch <= '9'):
+			if top == nil || top.state != jsonExpectValue {
+				return "", false
+			}
+			number = string(ch)
+		default:
+			return "", false
+		}
+	}
+
+	var suffix strings.Builder
+	switch {
+	case inString:
+		if unicodeDigits >= 0 {
+			suffix.WriteString(strings.Repeat("0", 4-unicodeDigits))
+		} else if escaped {
+			suffix.WriteByte('\\')
+		}
+		suffix.WriteByte('"')
+		if stringIsKey {
+			suffix.WriteString(":null")
+		}
+	case literal != "":
+		completed := false
+		for _, candidate := range []string{"true", "false", "null"} {
+			if strings.HasPrefix(candidate, literal) {
+				suffix.WriteString(candidate[len(literal):])
+				completed = true
+				break
+			}
+		}
+		if !completed {
+			return "", false
+		}
+	case number != "":
+		if last := number[len(number)-1]; last < '0' || last > '9' {
+			suffix.WriteByte('0')
+		}
+	case len(stack) > 0:
+		top := stack[len(stack)-1]
+		if top.afterComma {
+			return "", false
+		}
+		switch top.state {
+		case jsonExpectColon:
+			suffix.WriteString(":null")
+		case jsonExpectValue:
+			if top.closer == '}' {
+				suffix.WriteString("null")
+			}
+		}
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		suffix.WriteByte(stack[i].closer)
+	}
+
+	var object map[string]any
+	if json.Unmarshal([]byte(prefix+suffix.String()), &object) != nil {
+		return "", false
+	}
+	return suffix.String(), true
+}
@@ -0,0 +1,60 @@
+package core
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCompleteJSONObject(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		suffix string
+		ok     bool
+	}{
+		{name: "empty", prefix: "", suffix: "{}", ok: true},
+		{name: "whitespace", prefix: "  ", suffix: "{}", ok: true},
+		{name: "complete", prefix: `{"a":1}`, suffix: "", ok: true},
+		{name: "open object", prefix: `{`, suffix: "}", ok: true},
+		{name: "open key", prefix: `{"pa`, suffix: `":null}`, ok: true},
+		{name: "key without colon", prefix: `{"path"`, suffix: ":null}", ok: true},
+		{name: "missing value", prefix: `{"path":`, suffix: "null}", ok: true},
+		{name: "open string", prefix: `{"path":"/tm`, suffix: `"}`, ok: true},
+		{name: "trailing backslash", prefix: `{"path":"C:\`, suffix: `\"}`, ok: true},
+		{name: "partial unicode escape", prefix: `{"s":"\u00e`, suffix: `0"}`, ok: true},
+		{name: "integer", prefix: `{"n":12`, suffix: "}", ok: true},
+		{name: "minus sign", prefix: `{"n":-`, suffix: "0}", ok: true},
+		{name: "decimal point", prefix: `{"n":1.`, suffix: "0}", ok: true},
+		{name: "exponent", prefix: `{"n":1e`, suffix: "0}", ok: true},
+		{name: "partial true", prefix: `{"b":tr`, suffix: "ue}", ok: true},
+		{name: "partial false", prefix: `{"b":f`, suffix: "alse}", ok: true},
+		{name: "partial null", prefix: `{"b":nu`, suffix: "ll}", ok: true},
+		{name: "nested containers", prefix: `{"a":[1,{"b":`, suffix: "null}]}", ok: true},
+		{name: "open array", prefix: `{"a":[`, suffix: "]}", ok: true},
+		{name: "array after value", prefix: `{"a":["x"`, suffix: "]}", ok: true},
+		{name: "trailing comma in object", prefix: `{"a":1,`, ok: false},
+		{name: "trailing comma in array", prefix: `{"a":[1,`, ok: false},
+		{name: "invalid literal", prefix: `{"b":tx`, ok: false},
+		{name: "unknown literal", prefix: `{"b":nope`, ok: false},
+		{name: "invalid unicode escape", prefix: `{"s":"\u00g`, ok: false},
+		{name: "not an object", prefix: `[1,2`, ok: false},
+		{name: "content after the object", prefix: `{"a":1} {`, ok: false},
+		{name: "value without key", prefix: `{1`, ok: false},
+		{name: "mismatched closer", prefix: `{"a":[1}`, ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suffix, ok := CompleteJSONObject(tt.prefix)
+			if ok != tt.ok || suffix != tt.suffix {
+				t.Fatalf("CompleteJSONObject(%q) = %q, %t, want %q, %t", tt.prefix, suffix, ok, tt.suffix, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			var object map[string]any
+			if err := json.Unmarshal([]byte(tt.prefix+suffix), &object); err != nil {
+				t.Errorf("%q is not a JSON object: %v", tt.prefix+suffix, err)
+			}
+		})
+	}
+}
@@ -1,12 +1,26 @@
 package core
 
 import (
+	"log"
 	"strings"
 	"sync"
 )
 
+// DEFAULT_CLAUDE_MODELS are the Claude models /v1/models lists besides the aliases of the
+// routing file, newest first.
+var DEFAULT_CLAUDE_MODELS = []string{
+	"claude-sonnet-4-5-20250929",
+	"claude-haiku-4-5-20251001",
+	"claude-opus-4-1-20250805",
+	"claude-opus-4-20250514",
+	"claude-sonnet-4-20250514",
+	"claude-3-7-sonnet-20250219",
+	"claude-3-5-haiku-20241022",
+}
+
 type ModelManager struct {
-	Config *Config
+	Config  *Config
+	Routing *RoutingConfig
 }
 
 var (
@@ -16,19 +30,109 @@ var (
 
 func GetModelManager() *ModelManager {
 	managerOnce.Do(func() {
-		managerInstance = &ModelManager{Config: GetConfig()}
+		managerInstance = NewModelManager(GetConfig())
 	})
 	return managerInstance
 }
 
+func NewModelManager(config *Config) *ModelManager {
+	manager := &ModelManager{Config: config, Routing: &RoutingConfig{}}
+	if config.RoutesConfig != "" {
+		routing, err := LoadRoutingConfig(config.RoutesConfig)
+		if err != nil {
+			log.Fatalf("Failed to load routing config: %v", err)
+		}
+		manager.Routing = routing
+	}
+	return manager
+}
+
+// Provider returns the named provider. The "default" provider comes from the environment
+// unless the routing file declares its own.
+func (m *ModelManager) Provider(name string) *ProviderConfig {
+	if provider := m.Routing.Provider(name); provider != nil {
+		return provider
+	}
+	if name == "" || name == DEFAULT_PROVIDER {
+		return m.Config.DefaultProvider()
+	}
+	return nil
+}
+
+// Providers returns every provider requests can be routed to.
+func (m *ModelManager) Providers() []*ProviderConfig {
+	providers := []*ProviderConfig{m.Provider(DEFAULT_PROVIDER)}
+	for i := range m.Routing.Providers {
+		if m.Routing.Providers[i].Name != DEFAULT_PROVIDER {
+			providers = append(providers, &m.Routing.Providers[i])
+		}
+	}
+	return providers
+}
+
+// Route picks the provider and upstream model for a requested model. The first matching rule
+// of the routing table wins; without a match the default provider and tier mapping are used.
+func (m *ModelManager) Route(claudeModel string) Route {
+	for _, rule := range m.Routing.Routes {
+		if !rule.Matches(claudeModel) {
+			continue
+		}
+		model := rule.Model
+		if model == "" {
+			model = claudeModel
+		}
+		route := Route{Provider: m.Provider(rule.Provider), Model: model}
+		for _, fallback := range rule.Fallbacks {
+			route.Fallbacks = append(route.Fallbacks, Route{Provider: m.Provider(fallback.Provider), Model: fallback.Model})
+		}
+		return route
+	}
+	return Route{Provider: m.Provider(DEFAULT_PROVIDER), Model: m.MapClaudeModelToOpenAI(claudeModel)}
+}
+
+// HasRoute reports whether a rule of the routing table matches the model.
+func (m *ModelManager) HasRoute(claudeModel string) bool {
+	for _, rule := range m.Routing.Routes {
+		if rule.Matches(claudeModel) {
+			return true
+		}
+	}
+	return false
+}
+
+// Aliases returns the model names clients can choose from: the aliases of the routing rules in
+// order, then the default Claude models.
+func (m *ModelManager) Aliases() []string {
+	aliases := []string{}
+	seen := map[string]bool{}
+	add := func(alias string) {
+		if !seen[alias] {
+			seen[alias] = true
+			aliases = append(aliases, alias)
+		}
+	}
+	for _, rule := range m.Routing.Routes {
+		if rule.MatchType == MATCH_EXACT {
+			add(rule.Match)
+		}
+		for _, alias := range rule.Aliases {
+			add(alias)
+		}
+	}
+	for _, model := range DEFAULT_CLAUDE_MODELS {
+		add(model)
+	}
+	return aliases
+}
+
 func (m *ModelManager) MapClaudeModelToOpenAI(claudeModel string) string {
 	// If it's already an OpenAI model, return as-is
-	if len(claudeModel) >= 4 && (claudeModel[:4] == "gpt-" || claudeModel[:3] == "o1-") {
+	if strings.HasPrefix(claudeModel, "gpt-") || strings.HasPrefix(claudeModel, "o1-") {
 		return claudeModel
 	}
 
 	// If it's other supported models (ARK/Doubao/DeepSeek), return as-is
-	if len(claudeModel) >= 3 && (claudeModel[:3] == "ep-" || claudeModel[:8] == "doubao-" || claudeModel[:9] == "deepseek-") {
+	if strings.HasPrefix(claudeModel, "ep-") || strings.HasPrefix(claudeModel, "doubao-") || strings.HasPrefix(claudeModel, "deepseek-") {
 		return claudeModel
 	}
 
@@ -45,3 +149,17 @@ func (m *ModelManager) MapClaudeModelToOpenAI(claudeModel string) string {
 	// Default to big model for unknown models
 	return m.Config.BigModel
 }
+
+// MapOpenAIModelToAzureDeployment returns the Azure deployment serving an upstream model.
+// Models outside the big/middle/small tiers fall back to Azure's naming rule of dropping '.' and ':'.
+func (m *ModelManager) MapOpenAIModelToAzureDeployment(model string) string {
+	switch model {
+	case m.Config.BigModel:
+		return m.Config.AzureBigDeployment
+	case m.Config.MiddleModel:
+		return m.Config.AzureMiddleDeployment
+	case m.Config.SmallModel:
+		return m.Config.AzureSmallDeployment
+	}
+	return strings.NewReplacer(".", "", ":", "").Replace(model)
+}
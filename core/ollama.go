@@ -0,0 +1,21 @@
+package core
+
+// OllamaModelOptions are the settings an ollama provider sends with requests for a model.
+type OllamaModelOptions struct {
+	// NumCtx sets the context window, which Ollama otherwise keeps small and silently truncates to
+	NumCtx int `json:"num_ctx,omitempty"`
+	// KeepAlive is how long the model stays loaded after a request, like "30m" or "-1"
+	KeepAlive string `json:"keep_alive,omitempty"`
+	// Think overrides the think request field: true, false, or "low", "medium", "high" for gpt-oss.
+	// Unset follows the thinking setting of the Claude request.
+	Think any `json:"think,omitempty"`
+	// Options are passed through as additional Ollama model options, like num_gpu or repeat_penalty
+	Options map[string]any `json:"options,omitempty"`
+}
+
+// OllamaOptions returns the settings of a model: an exact entry wins, otherwise the longest
+// matching glob pattern.
+func (p *ProviderConfig) OllamaOptions(model string) OllamaModelOptions {
+	options, _ := lookupPattern(p.Ollama, model)
+	return options
+}
@@ -0,0 +1,43 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Strategies for prompts exceeding the context window of the upstream model, tried in the
+// configured order until the prompt fits.
+const (
+	// OVERFLOW_TRUNCATE_TOOL_RESULTS shortens large tool outputs of earlier turns, keeping their start and end
+	OVERFLOW_TRUNCATE_TOOL_RESULTS = "truncate_tool_results"
+	// OVERFLOW_DROP_TOOL_RESULTS replaces the outputs of the oldest tool calls with a marker
+	OVERFLOW_DROP_TOOL_RESULTS = "drop_tool_results"
+	// OVERFLOW_SUMMARIZE replaces the older turns with a summary written by the small model
+	OVERFLOW_SUMMARIZE = "summarize"
+	// OVERFLOW_REJECT fails with "prompt is too long", which makes Claude Code compact the conversation
+	OVERFLOW_REJECT = "reject"
+)
+
+// ParseOverflowStrategies parses a comma separated list of overflow strategies.
+func ParseOverflowStrategies(value string) ([]string, error) {
+	strategies := []string{}
+	for _, strategy := range strings.Split(value, ",") {
+		strategy = strings.TrimSpace(strategy)
+		if strategy == "" {
+			continue
+		}
+		if err := validateOverflowStrategy(strategy); err != nil {
+			return nil, err
+		}
+		strategies = append(strategies, strategy)
+	}
+	return strategies, nil
+}
+
+func validateOverflowStrategy(strategy string) error {
+	switch strategy {
+	case OVERFLOW_TRUNCATE_TOOL_RESULTS, OVERFLOW_DROP_TOOL_RESULTS, OVERFLOW_SUMMARIZE, OVERFLOW_REJECT:
+		return nil
+	}
+	return fmt.Errorf("unknown context overflow strategy %q", strategy)
+}
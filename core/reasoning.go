@@ -0,0 +1,73 @@
+package core
+
+import "strings"
+
+// Ways of asking an upstream for extended thinking.
+const (
+	// REASONING_EFFORT sets reasoning_effort, for OpenAI reasoning models
+	REASONING_EFFORT = "reasoning_effort"
+	// REASONING_DEEPSEEK sets chat_template_kwargs.thinking, for hybrid DeepSeek models served by vLLM or SGLang
+	REASONING_DEEPSEEK = "deepseek"
+	// REASONING_DOUBAO sets the top level thinking object of Volcengine Ark
+	REASONING_DOUBAO = "doubao"
+	// REASONING_NONE drops the thinking setting
+	REASONING_NONE = "none"
+
+	REASONING_EFFORT_LOW    = "low"
+	REASONING_EFFORT_MEDIUM = "medium"
+	REASONING_EFFORT_HIGH   = "high"
+)
+
+// Thinking budgets from which a higher reasoning effort is requested. Claude Code asks for about
+// 4k tokens for "think", 10k for "think hard" and 32k for "ultrathink".
+const (
+	REASONING_MEDIUM_BUDGET = 8000
+	REASONING_HIGH_BUDGET   = 24000
+)
+
+// ReasoningStyle returns how extended thinking is requested for a model on a provider.
+func ReasoningStyle(provider *ProviderConfig, model string) string {
+	if provider != nil && provider.Reasoning != "" {
+		return provider.Reasoning
+	}
+	model = strings.ToLower(model)
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		model = model[i+1:]
+	}
+	switch {
+	case strings.HasPrefix(model, "o1"), strings.HasPrefix(model, "o3"), strings.HasPrefix(model, "o4"),
+		strings.HasPrefix(model, "gpt-5"), strings.HasPrefix(model, "gpt-oss"):
+		return REASONING_EFFORT
+	case strings.Contains(model, "deepseek"):
+		return REASONING_DEEPSEEK
+	case strings.Contains(model, "doubao"):
+		return REASONING_DOUBAO
+	}
+	return REASONING_NONE
+}
+
+// ReasoningEffortForBudget maps a Claude thinking budget to an OpenAI reasoning effort.
+func ReasoningEffortForBudget(budgetTokens int) string {
+	switch {
+	case budgetTokens >= REASONING_HIGH_BUDGET:
+		return REASONING_EFFORT_HIGH
+	case budgetTokens >= REASONING_MEDIUM_BUDGET:
+		return REASONING_EFFORT_MEDIUM
+	}
+	return REASONING_EFFORT_LOW
+}
+
+// ReasoningBudgetForEffort maps an OpenAI reasoning effort to a Claude thinking budget, using the
+// budgets Claude Code asks for, so that ReasoningEffortForBudget maps it back. Other efforts,
+// like "minimal", map to 0 for no thinking.
+func ReasoningBudgetForEffort(effort string) int {
+	switch effort {
+	case REASONING_EFFORT_HIGH:
+		return 32000
+	case REASONING_EFFORT_MEDIUM:
+		return 10000
+	case REASONING_EFFORT_LOW:
+		return 4000
+	}
+	return 0
+}
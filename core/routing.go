@@ -0,0 +1,252 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	PROVIDER_OPENAI = "openai"
+	PROVIDER_AZURE  = "azure"
+	// PROVIDER_RESPONSES talks to the OpenAI Responses API instead of chat completions
+	PROVIDER_RESPONSES = "responses"
+	// PROVIDER_GEMINI talks to the native Gemini generateContent API
+	PROVIDER_GEMINI = "gemini"
+
+	// PROVIDER_OLLAMA talks to the native Ollama /api/chat API
+	PROVIDER_OLLAMA = "ollama"
+	// PROVIDER_ANTHROPIC forwards Claude requests unchanged to the Anthropic API or a compatible gateway
+	PROVIDER_ANTHROPIC = "anthropic"
+
+	GEMINI_DEFAULT_BASE_URL    = "https://generativelanguage.googleapis.com/v1beta"
+	OLLAMA_DEFAULT_BASE_URL    = "http://localhost:11434"
+	ANTHROPIC_DEFAULT_BASE_URL = "https://api.anthropic.com"
+
+	DEFAULT_PROVIDER = "default"
+
+	MATCH_EXACT = "exact"
+	MATCH_GLOB  = "glob"
+	MATCH_REGEX = "regex"
+)
+
+// ProviderConfig describes one upstream the proxy can send requests to.
+type ProviderConfig struct {
+	Name       string            `json:"name"`
+	Type       string            `json:"type,omitempty"`
+	BaseURL    string            `json:"base_url"`
+	APIKey     string            `json:"api_key,omitempty"`
+	APIVersion string            `json:"api_version,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	// Reasoning selects how extended thinking is requested from this provider, see REASONING_*.
+	// Empty infers it from the upstream model name.
+	Reasoning string `json:"reasoning,omitempty"`
+	// Ollama holds per model settings of ollama providers, keyed by model name or glob pattern
+	Ollama map[string]OllamaModelOptions `json:"ollama,omitempty"`
+}
+
+// RouteTarget names an upstream model on a provider.
+type RouteTarget struct {
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model"`
+}
+
+// RouteRule maps requested model names to a provider and an upstream model.
+// An empty Model passes the requested model name through unchanged. Fallbacks are tried
+// in order when the upstream model fails with a retryable or context-length error.
+// Aliases are the model names /v1/models lists for the rule; exact rules list their match.
+type RouteRule struct {
+	Match     string        `json:"match"`
+	MatchType string        `json:"match_type,omitempty"`
+	Provider  string        `json:"provider,omitempty"`
+	Model     string        `json:"model,omitempty"`
+	Fallbacks []RouteTarget `json:"fallbacks,omitempty"`
+	Aliases   []string      `json:"aliases,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// RoutingConfig is the content of the file referenced by ROUTES_CONFIG. Models overrides the
+// built-in profiles of upstream models, keyed by model name or glob pattern.
+type RoutingConfig struct {
+	Providers []ProviderConfig        `json:"providers"`
+	Routes    []RouteRule             `json:"routes"`
+	Models    map[string]ModelProfile `json:"models,omitempty"`
+}
+
+// Route is the outcome of routing a requested model.
+type Route struct {
+	Provider  *ProviderConfig
+	Model     string
+	Fallbacks []Route
+}
+
+// Candidates returns the route followed by its fallbacks, in the order they should be tried.
+func (r Route) Candidates() []Route {
+	candidates := []Route{{Provider: r.Provider, Model: r.Model}}
+	return append(candidates, r.Fallbacks...)
+}
+
+// LoadRoutingConfig reads and validates a routing file. Values of api_key, base_url and headers
+// may reference environment variables as ${VAR}.
+func LoadRoutingConfig(filename string) (*RoutingConfig, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var routing RoutingConfig
+	if err := json.Unmarshal(data, &routing); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", filename, err)
+	}
+
+	names := map[string]bool{}
+	for i := range routing.Providers {
+		provider := &routing.Providers[i]
+		if provider.Name == "" {
+			return nil, fmt.Errorf("provider #%d has no name", i)
+		}
+		if names[provider.Name] {
+			return nil, fmt.Errorf("duplicate provider %q", provider.Name)
+		}
+		names[provider.Name] = true
+		switch provider.Type {
+		case "":
+			provider.Type = PROVIDER_OPENAI
+		case PROVIDER_OPENAI, PROVIDER_AZURE, PROVIDER_RESPONSES, PROVIDER_GEMINI, PROVIDER_OLLAMA, PROVIDER_ANTHROPIC:
+		default:
+			return nil, fmt.Errorf("provider %q has unknown type %q", provider.Name, provider.Type)
+		}
+		switch provider.Reasoning {
+		case "", REASONING_EFFORT, REASONING_DEEPSEEK, REASONING_DOUBAO, REASONING_NONE:
+		default:
+			return nil, fmt.Errorf("provider %q has unknown reasoning %q", provider.Name, provider.Reasoning)
+		}
+		provider.BaseURL = os.ExpandEnv(provider.BaseURL)
+		if provider.BaseURL == "" {
+			switch provider.Type {
+			case PROVIDER_GEMINI:
+				provider.BaseURL = GEMINI_DEFAULT_BASE_URL
+			case PROVIDER_OLLAMA:
+				provider.BaseURL = OLLAMA_DEFAULT_BASE_URL
+			case PROVIDER_ANTHROPIC:
+				provider.BaseURL = ANTHROPIC_DEFAULT_BASE_URL
+			}
+		}
+		provider.APIKey = os.ExpandEnv(provider.APIKey)
+		for key, value := range provider.Headers {
+			provider.Headers[key] = os.ExpandEnv(value)
+		}
+	}
+
+	for i := range routing.Routes {
+		rule := &routing.Routes[i]
+		if rule.Provider != "" && rule.Provider != DEFAULT_PROVIDER && !names[rule.Provider] {
+			return nil, fmt.Errorf("route %q references unknown provider %q", rule.Match, rule.Provider)
+		}
+		for _, fallback := range rule.Fallbacks {
+			if fallback.Model == "" {
+				return nil, fmt.Errorf("route %q has a fallback without model", rule.Match)
+			}
+			if fallback.Provider != "" && fallback.Provider != DEFAULT_PROVIDER && !names[fallback.Provider] {
+				return nil, fmt.Errorf("route %q fallback references unknown provider %q", rule.Match, fallback.Provider)
+			}
+		}
+		if rule.MatchType == "" {
+			rule.MatchType = MATCH_EXACT
+			if strings.ContainsAny(rule.Match, "*?[") {
+				rule.MatchType = MATCH_GLOB
+			}
+		}
+		switch rule.MatchType {
+		case MATCH_EXACT:
+		case MATCH_GLOB:
+			if _, err := path.Match(rule.Match, ""); err != nil {
+				return nil, fmt.Errorf("route %q: %w", rule.Match, err)
+			}
+		case MATCH_REGEX:
+			pattern, err := regexp.Compile(rule.Match)
+			if err != nil {
+				return nil, fmt.Errorf("route %q: %w", rule.Match, err)
+			}
+			rule.pattern = pattern
+		default:
+			return nil, fmt.Errorf("route %q has unknown match_type %q", rule.Match, rule.MatchType)
+		}
+	}
+
+	for pattern, profile := range routing.Models {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("models %q: %w", pattern, err)
+		}
+		if err := profile.validate(); err != nil {
+			return nil, fmt.Errorf("models %q: %w", pattern, err)
+		}
+	}
+	return &routing, nil
+}
+
+// lookupPattern finds the entry of a model in a map keyed by model name or glob pattern: an exact
+// entry wins, otherwise the longest matching pattern.
+func lookupPattern[T any](entries map[string]T, model string) (T, bool) {
+	if entry, ok := entries[model]; ok {
+		return entry, true
+	}
+	patterns := []string{}
+	for pattern := range entries {
+		if ok, _ := path.Match(pattern, model); ok {
+			patterns = append(patterns, pattern)
+		}
+	}
+	if len(patterns) == 0 {
+		var zero T
+		return zero, false
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) > len(patterns[j])
+		}
+		return patterns[i] < patterns[j]
+	})
+	return entries[patterns[0]], true
+}
+
+func (r *RouteRule) Matches(model string) bool {
+	switch r.MatchType {
+	case MATCH_GLOB:
+		ok, _ := path.Match(r.Match, model)
+		return ok
+	case MATCH_REGEX:
+		return r.pattern.MatchString(model)
+	default:
+		return r.Match == model
+	}
+}
+
+// Provider returns the provider with the given name, or nil.
+func (r *RoutingConfig) Provider(name string) *ProviderConfig {
+	for i := range r.Providers {
+		if r.Providers[i].Name == name {
+			return &r.Providers[i]
+		}
+	}
+	return nil
+}
+
+// DefaultProvider builds the provider described by the OPENAI_* and AZURE_* environment variables.
+func (c *Config) DefaultProvider() *ProviderConfig {
+	provider := &ProviderConfig{
+		Name:    DEFAULT_PROVIDER,
+		Type:    PROVIDER_OPENAI,
+		BaseURL: c.OpenAIBaseURL,
+		APIKey:  c.OpenAIAPIKey,
+	}
+	if c.IsAzure() {
+		provider.Type = PROVIDER_AZURE
+		provider.APIVersion = c.AzureAPIVersion
+	}
+	return provider
+}
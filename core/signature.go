@@ -0,0 +1,148 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// SIGNATURE_PREFIX marks signatures embedding the reasoning state
+	SIGNATURE_PREFIX = "ccp1."
+	// SIGNATURE_REF_PREFIX marks signatures referencing a reasoning state in THINKING_STORE_DIR
+	SIGNATURE_REF_PREFIX = "ccp1r."
+	// SIGNATURE_EMBED_LIMIT is the largest encoded state embedded when a store is configured
+	SIGNATURE_EMBED_LIMIT = 4096
+	// THINKING_STORE_PRUNE_INTERVAL is how often writing to the store looks for expired states
+	THINKING_STORE_PRUNE_INTERVAL = time.Hour
+
+	// REASONING_STATE_CONTENT is reasoning_content the upstream wants echoed in later turns
+	REASONING_STATE_CONTENT = "reasoning_content"
+	// REASONING_STATE_ENCRYPTED is an encrypted reasoning item only the upstream can read
+	REASONING_STATE_ENCRYPTED = "encrypted"
+)
+
+// ReasoningState is the upstream reasoning carried by the signature of a thinking or the data of
+// a redacted_thinking block, so it can be restored when Claude Code sends the block back.
+type ReasoningState struct {
+	Kind     string `json:"k"`
+	Provider string `json:"p"`
+	Model    string `json:"m"`
+	// ItemID and Encrypted hold an encrypted reasoning item
+	ItemID    string `json:"i,omitempty"`
+	Encrypted string `json:"e,omitempty"`
+}
+
+// Matches reports whether the state was produced by the upstream a route sends to. Reasoning
+// state is only meaningful to the model that produced it.
+func (s *ReasoningState) Matches(route Route) bool {
+	return route.Provider != nil && s.Provider == route.Provider.Name && s.Model == route.Model
+}
+
+// MintSignature encodes a reasoning state as a signature. States larger than SIGNATURE_EMBED_LIMIT
+// are kept in THINKING_STORE_DIR when it is set and referenced by their hash.
+func MintSignature(state ReasoningState) string {
+	data, _ := json.Marshal(state)
+	if dir := GetConfig().ThinkingStoreDir; dir != "" && len(data) > SIGNATURE_EMBED_LIMIT {
+		sum := sha256.Sum256(data)
+		key := hex.EncodeToString(sum[:])
+		err := os.MkdirAll(dir, 0o700)
+		if err == nil {
+			err = os.WriteFile(filepath.Join(dir, key+".json"), data, 0o600)
+		}
+		if err == nil {
+			pruneThinkingStore(dir)
+			return SIGNATURE_REF_PREFIX + key
+		}
+		log.Printf("Failed to store reasoning state, embedding it instead: %v", err)
+	}
+	return SIGNATURE_PREFIX + base64.RawURLEncoding.EncodeToString(data)
+}
+
+// lastThinkingStorePrune is when pruneThinkingStore last scanned the store.
+var lastThinkingStorePrune = struct {
+	sync.Mutex
+	at time.Time
+}{}
+
+// pruneThinkingStore deletes the states not written or read for THINKING_STORE_MAX_AGE_DAYS, at
+// most once per THINKING_STORE_PRUNE_INTERVAL. The thinking blocks referencing them can no longer
+// be restored, like those of conversations resumed after a restart without a store.
+func pruneThinkingStore(dir string) {
+	maxAgeDays := GetConfig().ThinkingStoreMaxAgeDays
+	if maxAgeDays <= 0 {
+		return
+	}
+	lastThinkingStorePrune.Lock()
+	now := time.Now()
+	if now.Sub(lastThinkingStorePrune.at) < THINKING_STORE_PRUNE_INTERVAL {
+		lastThinkingStorePrune.Unlock()
+		return
+	}
+	lastThinkingStorePrune.at = now
+	lastThinkingStorePrune.Unlock()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Printf("Failed to prune the reasoning states in %s: %v", dir, err)
+		return
+	}
+	expiry := now.AddDate(0, 0, -maxAgeDays)
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(expiry) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to delete the expired reasoning state %s: %v", entry.Name(), err)
+		}
+	}
+}
+
+// ParseSignature decodes a signature minted by MintSignature. Signatures of other origins, like
+// real Anthropic signatures, and references missing from the store are reported as not ok.
+func ParseSignature(signature string) (*ReasoningState, bool) {
+	var data []byte
+	switch {
+	case strings.HasPrefix(signature, SIGNATURE_REF_PREFIX):
+		key := strings.TrimPrefix(signature, SIGNATURE_REF_PREFIX)
+		dir := GetConfig().ThinkingStoreDir
+		if dir == "" || len(key) != sha256.Size*2 || strings.ContainsAny(key, `/\.`) {
+			return nil, false
+		}
+		path := filepath.Join(dir, key+".json")
+		stored, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("Reasoning state %s not found in %s: %v", key, dir, err)
+			return nil, false
+		}
+		// States of conversations still going on are kept, expiry counts from the last use
+		now := time.Now()
+		os.Chtimes(path, now, now)
+		data = stored
+	case strings.HasPrefix(signature, SIGNATURE_PREFIX):
+		decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(signature, SIGNATURE_PREFIX))
+		if err != nil {
+			return nil, false
+		}
+		data = decoded
+	default:
+		return nil, false
+	}
+
+	var state ReasoningState
+	if err := json.Unmarshal(data, &state); err != nil || state.Kind == "" {
+		return nil, false
+	}
+	return &state, true
+}
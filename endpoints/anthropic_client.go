@@ -0,0 +1,184 @@
+package endpoints
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+	"github.com/jiaobendaye/go-claude-code-proxy/models"
+	"github.com/jiaobendaye/go-claude-code-proxy/streaming"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	HEADER_ANTHROPIC_VERSION = "anthropic-version"
+	HEADER_ANTHROPIC_BETA    = "anthropic-beta"
+
+	ANTHROPIC_DEFAULT_VERSION = "2023-06-01"
+)
+
+// clientRequest is the request as the client sent it, kept for passthrough upstreams.
+type clientRequest struct {
+	body   []byte
+	header http.Header
+}
+
+type clientRequestKey struct{}
+
+// withClientRequest stores the raw body and headers of the client request. The body must have
+// been bound with ShouldBindBodyWith, which keeps it in the gin context.
+func withClientRequest(ctx context.Context, c *gin.Context) context.Context {
+	body, ok := c.Get(gin.BodyBytesKey)
+	if !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, clientRequestKey{}, &clientRequest{body: body.([]byte), header: c.Request.Header})
+}
+
+// anthropicClient forwards requests to the Anthropic API or a compatible gateway. Requests are sent
+// as the client sent them, with only the model replaced by the routed one; requests that did not
+// come from an Anthropic client are encoded from the parsed request. Failures are reported as
+// go-openai errors like for the other plain HTTP upstreams.
+type anthropicClient struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+func newAnthropicClient(provider *core.ProviderConfig) *anthropicClient {
+	return &anthropicClient{
+		baseURL:    strings.TrimSuffix(provider.BaseURL, "/"),
+		apiKey:     provider.APIKey,
+		httpClient: newProviderHTTPClient(provider),
+	}
+}
+
+// requestBody returns the body to forward: the client's body, or parsed encoded, with the model
+// and, for messages, the stream flag replaced.
+func (c *anthropicClient) requestBody(ctx context.Context, parsed any, model string, stream *bool) ([]byte, error) {
+	body := []byte(nil)
+	if inbound, ok := ctx.Value(clientRequestKey{}).(*clientRequest); ok {
+		body = inbound.body
+	} else {
+		encoded, err := json.Marshal(parsed)
+		if err != nil {
+			return nil, err
+		}
+		body = encoded
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	// An unset thinking setting encodes as an empty object, which Anthropic rejects
+	if thinking, ok := fields["thinking"]; ok && string(thinking) == "{}" {
+		delete(fields, "thinking")
+	}
+	fields["model"], _ = json.Marshal(model)
+	if stream != nil {
+		fields["stream"], _ = json.Marshal(*stream)
+	}
+	return json.Marshal(fields)
+}
+
+// post sends a request with the proxy's own credentials. anthropic-version and anthropic-beta are
+// taken from the client, headers configured on the provider override them.
+func (c *anthropicClient) post(ctx context.Context, path string, body []byte, stream bool) (*http.Response, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", c.apiKey)
+	httpReq.Header.Set(HEADER_ANTHROPIC_VERSION, ANTHROPIC_DEFAULT_VERSION)
+	if inbound, ok := ctx.Value(clientRequestKey{}).(*clientRequest); ok {
+		if version := inbound.header.Get(HEADER_ANTHROPIC_VERSION); version != "" {
+			httpReq.Header.Set(HEADER_ANTHROPIC_VERSION, version)
+		}
+		if betas := inbound.header.Values(HEADER_ANTHROPIC_BETA); len(betas) > 0 {
+			httpReq.Header.Set(HEADER_ANTHROPIC_BETA, strings.Join(betas, ","))
+		}
+	}
+	if stream {
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		return nil, decodeUpstreamError(resp)
+	}
+	return resp, nil
+}
+
+// postJSON sends a non streaming request and decodes the JSON response, numbers kept as sent.
+func (c *anthropicClient) postJSON(ctx context.Context, path string, body []byte) (map[string]any, error) {
+	resp, err := c.post(ctx, path, body, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	var response map[string]any
+	err = decoder.Decode(&response)
+	return response, err
+}
+
+func (c *anthropicClient) createMessage(ctx context.Context, req *models.ClaudeMessagesRequest, model string) (map[string]any, error) {
+	stream := false
+	body, err := c.requestBody(ctx, req, model, &stream)
+	if err != nil {
+		return nil, err
+	}
+	return c.postJSON(ctx, "/v1/messages", body)
+}
+
+func (c *anthropicClient) createStream(ctx context.Context, req *models.ClaudeMessagesRequest, model string) (*anthropicEventStream, error) {
+	stream := true
+	body, err := c.requestBody(ctx, req, model, &stream)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.post(ctx, "/v1/messages", body, true)
+	if err != nil {
+		return nil, err
+	}
+	return &anthropicEventStream{sseStream: newSSEStream[models.ClaudeStreamEvent](resp.Body)}, nil
+}
+
+func (c *anthropicClient) countTokens(ctx context.Context, req *models.ClaudeTokenCountRequest, model string) (map[string]any, error) {
+	body, err := c.requestBody(ctx, req, model, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.postJSON(ctx, "/v1/messages/count_tokens", body)
+}
+
+// anthropicEventStream turns error events into go-openai errors, so an error arriving as the first
+// event can still be retried or fall back like an error status.
+type anthropicEventStream struct {
+	*sseStream[models.ClaudeStreamEvent]
+}
+
+func (s *anthropicEventStream) Recv() (models.ClaudeStreamEvent, error) {
+	event, err := s.sseStream.Recv()
+	if err != nil || event.Type != streaming.EVENT_ERROR {
+		return event, err
+	}
+	var data struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	json.Unmarshal(event.Raw, &data)
+	return event, &openai.APIError{Type: data.Error.Type, Message: data.Error.Message, HTTPStatusCode: statusForErrorType(data.Error.Type)}
+}
@@ -0,0 +1,267 @@
+package endpoints
+
+import (
+	"context"
+
+	"github.com/jiaobendaye/go-claude-code-proxy/conversion"
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+	"github.com/jiaobendaye/go-claude-code-proxy/models"
+	"github.com/jiaobendaye/go-claude-code-proxy/streaming"
+	"github.com/sashabaranov/go-openai"
+)
+
+// backend sends Claude requests to the API spoken by one type of provider.
+type backend interface {
+	// createMessage returns the Claude response of a non streaming request.
+	createMessage(ctx context.Context, claudeRequest *models.ClaudeMessagesRequest, route core.Route) (map[string]any, error)
+	// createStream opens a stream and waits for its first event, so it can still fall back.
+	createStream(ctx context.Context, claudeRequest *models.ClaudeMessagesRequest, route core.Route) (messageStream, error)
+}
+
+// modelLister is implemented by backends that can enumerate the models installed upstream.
+type modelLister interface {
+	listModels(ctx context.Context) ([]models.ClaudeModelInfo, error)
+}
+
+// tokenCounter is implemented by backends that count tokens upstream instead of locally.
+type tokenCounter interface {
+	countTokens(ctx context.Context, req *models.ClaudeTokenCountRequest, route core.Route) (map[string]any, error)
+}
+
+// messageStream is an opened upstream stream, translated into Claude events by pipe.
+type messageStream interface {
+	pipe(ctx context.Context, t *streaming.Translator) error
+	Close() error
+}
+
+// relayStream is implemented by streams already in the Claude format, which are written to Claude
+// clients unchanged instead of through a translator.
+type relayStream interface {
+	relay(ctx context.Context, w *streaming.SSEWriter) error
+}
+
+// createMessage sends a request prepared for the route to its backend. It also returns the
+// request as sent.
+func createMessage(ctx context.Context, claudeRequest *models.ClaudeMessagesRequest, route core.Route) (map[string]any, *models.ClaudeMessagesRequest, error) {
+	prepared, err := prepareRequest(ctx, claudeRequest, route)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := backendForProvider(route.Provider).createMessage(ctx, prepared, route)
+	return resp, prepared, err
+}
+
+// createStream opens a stream for a request prepared for the route on its backend. It also
+// returns the request as sent.
+func createStream(ctx context.Context, claudeRequest *models.ClaudeMessagesRequest, route core.Route) (messageStream, *models.ClaudeMessagesRequest, error) {
+	prepared, err := prepareRequest(ctx, claudeRequest, route)
+	if err != nil {
+		return nil, nil, err
+	}
+	stream, err := backendForProvider(route.Provider).createStream(ctx, prepared, route)
+	return stream, prepared, err
+}
+
+// chatBackend talks to OpenAI compatible /chat/completions endpoints through go-openai.
+type chatBackend struct {
+	client *openai.Client
+}
+
+func (b *chatBackend) createMessage(ctx context.Context, claudeRequest *models.ClaudeMessagesRequest, route core.Route) (map[string]any, error) {
+	openaiReq := conversion.ConvertClaudeToOpenai(claudeRequest, route)
+	ctx = withExtraFields(ctx, conversion.ExtraRequestFields(claudeRequest, route))
+	resp, err := callWithRetry(ctx, openaiReq.Model, func(attemptCtx context.Context) (openai.ChatCompletionResponse, error) {
+		return b.client.CreateChatCompletion(attemptCtx, *openaiReq)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conversion.ConvertOpeenaiToClaudeResponse(resp, *claudeRequest, route), nil
+}
+
+func (b *chatBackend) createStream(ctx context.Context, claudeRequest *models.ClaudeMessagesRequest, route core.Route) (messageStream, error) {
+	openaiReq := conversion.ConvertClaudeToOpenai(claudeRequest, route)
+	ctx = withExtraFields(ctx, conversion.ExtraRequestFields(claudeRequest, route))
+	stream, err := openStreamWithRetry(ctx, openaiReq.Model, func(attemptCtx context.Context) (eventStream[openai.ChatCompletionStreamResponse], error) {
+		return b.client.CreateChatCompletionStream(attemptCtx, *openaiReq)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &chatStream{retryableStream: stream, route: route}, nil
+}
+
+type chatStream struct {
+	*retryableStream[openai.ChatCompletionStreamResponse]
+	route core.Route
+}
+
+func (s *chatStream) pipe(ctx context.Context, t *streaming.Translator) error {
+	t.SetThinkingSignature(conversion.ThinkingSignature(s.route))
+	return streaming.PipeOpenAIStream(ctx, s, t)
+}
+
+// responsesBackend talks to the OpenAI Responses API.
+type responsesBackend struct {
+	client *responsesClient
+}
+
+func (b *responsesBackend) createMessage(ctx context.Context, claudeRequest *models.ClaudeMessagesRequest, route core.Route) (map[string]any, error) {
+	req := conversion.ConvertClaudeToResponses(claudeRequest, route)
+	resp, err := callWithRetry(ctx, req.Model, func(attemptCtx context.Context) (models.ResponsesResponse, error) {
+		return b.client.create(attemptCtx, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conversion.ConvertResponsesToClaudeResponse(resp, *claudeRequest, route), nil
+}
+
+func (b *responsesBackend) createStream(ctx context.Context, claudeRequest *models.ClaudeMessagesRequest, route core.Route) (messageStream, error) {
+	req := conversion.ConvertClaudeToResponses(claudeRequest, route)
+	stream, err := openStreamWithRetry(ctx, req.Model, func(attemptCtx context.Context) (eventStream[models.ResponsesStreamEvent], error) {
+		return b.client.createStream(attemptCtx, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &responsesStream{retryableStream: stream, route: route}, nil
+}
+
+type responsesStream struct {
+	*retryableStream[models.ResponsesStreamEvent]
+	route core.Route
+}
+
+func (s *responsesStream) pipe(ctx context.Context, t *streaming.Translator) error {
+	return streaming.PipeResponsesStream(ctx, s, t, s.route)
+}
+
+// geminiBackend talks to the native Gemini generateContent API.
+type geminiBackend struct {
+	client *geminiClient
+}
+
+func (b *geminiBackend) createMessage(ctx context.Context, claudeRequest *models.ClaudeMessagesRequest, route core.Route) (map[string]any, error) {
+	req := conversion.ConvertClaudeToGemini(claudeRequest, route)
+	resp, err := callWithRetry(ctx, route.Model, func(attemptCtx context.Context) (models.GeminiResponse, error) {
+		return b.client.generate(attemptCtx, route.Model, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conversion.ConvertGeminiToClaudeResponse(resp, *claudeRequest, route), nil
+}
+
+func (b *geminiBackend) createStream(ctx context.Context, claudeRequest *models.ClaudeMessagesRequest, route core.Route) (messageStream, error) {
+	req := conversion.ConvertClaudeToGemini(claudeRequest, route)
+	stream, err := openStreamWithRetry(ctx, route.Model, func(attemptCtx context.Context) (eventStream[models.GeminiResponse], error) {
+		return b.client.generateStream(attemptCtx, route.Model, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &geminiStream{retryableStream: stream, route: route}, nil
+}
+
+type geminiStream struct {
+	*retryableStream[models.GeminiResponse]
+	route core.Route
+}
+
+func (s *geminiStream) pipe(ctx context.Context, t *streaming.Translator) error {
+	return streaming.PipeGeminiStream(ctx, s, t, s.route)
+}
+
+// ollamaBackend talks to the native Ollama /api/chat API.
+type ollamaBackend struct {
+	client *ollamaClient
+}
+
+func (b *ollamaBackend) createMessage(ctx context.Context, claudeRequest *models.ClaudeMessagesRequest, route core.Route) (map[string]any, error) {
+	req := conversion.ConvertClaudeToOllama(claudeRequest, route)
+	resp, err := callWithRetry(ctx, req.Model, func(attemptCtx context.Context) (models.OllamaChatResponse, error) {
+		return b.client.chat(attemptCtx, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conversion.ConvertOllamaToClaudeResponse(resp, *claudeRequest, route), nil
+}
+
+func (b *ollamaBackend) createStream(ctx context.Context, claudeRequest *models.ClaudeMessagesRequest, route core.Route) (messageStream, error) {
+	req := conversion.ConvertClaudeToOllama(claudeRequest, route)
+	stream, err := openStreamWithRetry(ctx, req.Model, func(attemptCtx context.Context) (eventStream[models.OllamaChatResponse], error) {
+		return b.client.chatStream(attemptCtx, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ollamaStream{retryableStream: stream, route: route}, nil
+}
+
+func (b *ollamaBackend) listModels(ctx context.Context) ([]models.ClaudeModelInfo, error) {
+	tags, err := b.client.tags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	modelInfos := []models.ClaudeModelInfo{}
+	for _, model := range tags.Models {
+		modelInfos = append(modelInfos, models.ClaudeModelInfo{
+			Type:        "model",
+			ID:          model.Name,
+			DisplayName: model.Name,
+			CreatedAt:   model.ModifiedAt,
+		})
+	}
+	return modelInfos, nil
+}
+
+type ollamaStream struct {
+	*retryableStream[models.OllamaChatResponse]
+	route core.Route
+}
+
+func (s *ollamaStream) pipe(ctx context.Context, t *streaming.Translator) error {
+	t.SetThinkingSignature(conversion.ThinkingSignature(s.route))
+	return streaming.PipeOllamaStream(ctx, s, t)
+}
+
+// anthropicBackend forwards requests to the Anthropic API without converting them.
+type anthropicBackend struct {
+	client *anthropicClient
+}
+
+func (b *anthropicBackend) createMessage(ctx context.Context, claudeRequest *models.ClaudeMessagesRequest, route core.Route) (map[string]any, error) {
+	return callWithRetry(ctx, route.Model, func(attemptCtx context.Context) (map[string]any, error) {
+		return b.client.createMessage(attemptCtx, claudeRequest, route.Model)
+	})
+}
+
+func (b *anthropicBackend) createStream(ctx context.Context, claudeRequest *models.ClaudeMessagesRequest, route core.Route) (messageStream, error) {
+	stream, err := openStreamWithRetry(ctx, route.Model, func(attemptCtx context.Context) (eventStream[models.ClaudeStreamEvent], error) {
+		return b.client.createStream(attemptCtx, claudeRequest, route.Model)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &anthropicStream{retryableStream: stream}, nil
+}
+
+func (b *anthropicBackend) countTokens(ctx context.Context, req *models.ClaudeTokenCountRequest, route core.Route) (map[string]any, error) {
+	return callWithRetry(ctx, route.Model, func(attemptCtx context.Context) (map[string]any, error) {
+		return b.client.countTokens(attemptCtx, req, route.Model)
+	})
+}
+
+type anthropicStream struct {
+	*retryableStream[models.ClaudeStreamEvent]
+}
+
+func (s *anthropicStream) pipe(ctx context.Context, t *streaming.Translator) error {
+	return streaming.PipeAnthropicStream(ctx, s, t)
+}
+
+func (s *anthropicStream) relay(ctx context.Context, w *streaming.SSEWriter) error {
+	return streaming.RelayClaudeStream(ctx, s, w)
+}
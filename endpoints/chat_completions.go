@@ -0,0 +1,96 @@
+package endpoints
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jiaobendaye/go-claude-code-proxy/conversion"
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+	"github.com/jiaobendaye/go-claude-code-proxy/models"
+	"github.com/jiaobendaye/go-claude-code-proxy/streaming"
+)
+
+const OPENAI_CHAT_COMPLETIONS_PATH = "/v1/chat/completions"
+
+// CreateChatCompletion serves OpenAI clients. The request is converted to a Claude request and goes
+// through the same routing, fallbacks and backends as /v1/messages; the Claude response or stream
+// is converted back to the chat completion format.
+func CreateChatCompletion(c *gin.Context) {
+	var openaiRequest models.OpenAIChatRequest
+	if err := c.ShouldBindJSON(&openaiRequest); err != nil {
+		abortWithError(c, newAnthropicError(http.StatusBadRequest, ERROR_INVALID_REQUEST, "Invalid JSON format: "+err.Error()))
+		return
+	}
+	claudeRequest, err := conversion.ConvertOpenaiToClaude(&openaiRequest)
+	if err != nil {
+		abortWithError(c, newAnthropicError(http.StatusBadRequest, ERROR_INVALID_REQUEST, err.Error()))
+		return
+	}
+	if err := conversion.ValidateContent(claudeRequest.Messages); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	// The client request is not kept, passthrough upstreams get the converted Claude request
+	route := core.GetModelManager().Route(claudeRequest.Model)
+	ctx := c.Request.Context()
+	var sent *models.ClaudeMessagesRequest
+
+	if !claudeRequest.Stream {
+		claudeResp, served, err := callWithFallbacks(ctx, claudeRequest.Model, route, func(candidate core.Route) (resp map[string]any, err error) {
+			resp, sent, err = createMessage(ctx, claudeRequest, candidate)
+			return resp, err
+		})
+		if err != nil {
+			log.Printf("Error creating chat completion: %v\n", err)
+			abortWithError(c, err)
+			return
+		}
+		setServedBy(c, served)
+		setAdjustedMaxTokens(c, claudeRequest.MaxTokens, sent)
+		openaiResp, err := conversion.ConvertClaudeToOpenaiResponse(claudeResp, openaiRequest.Model)
+		if err != nil {
+			log.Printf("Error converting chat completion: %v\n", err)
+			abortWithError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, openaiResp)
+		return
+	}
+
+	stream, served, err := callWithFallbacks(ctx, claudeRequest.Model, route, func(candidate core.Route) (stream messageStream, err error) {
+		stream, sent, err = createStream(ctx, claudeRequest, candidate)
+		return stream, err
+	})
+	if err != nil {
+		log.Printf("Error creating chat completion stream: %v\n", err)
+		abortWithError(c, err)
+		return
+	}
+	defer stream.Close()
+	setServedBy(c, served)
+	setAdjustedMaxTokens(c, claudeRequest.MaxTokens, sent)
+	streaming.SetSSEHeaders(c.Writer.Header())
+
+	// Relayed Claude streams are translated too, the chunks are built from translator events
+	messageId := "msg_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+	includeUsage := openaiRequest.StreamOptions != nil && openaiRequest.StreamOptions.IncludeUsage
+	writer := streaming.NewChatChunkWriter(c.Writer, conversion.ChatCompletionID(messageId), openaiRequest.Model, includeUsage)
+	translator := streaming.NewTranslator(streaming.NewValidator(writer), messageId, openaiRequest.Model)
+
+	err = stream.pipe(ctx, translator)
+	switch {
+	case ctx.Err() != nil:
+		log.Printf("Client disconnected, stopping stream processing %v", messageId)
+	case translator.Err() != nil:
+		log.Printf("Error writing stream %v: %v", messageId, translator.Err())
+		reportInvalidStream(writer, translator.Err())
+	case err != nil:
+		log.Printf("Error receiving stream: %v\n", err)
+		anthropicErr := translateError(err)
+		translator.Error(anthropicErr.Type, anthropicErr.Message)
+	}
+}
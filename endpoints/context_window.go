@@ -0,0 +1,92 @@
+package endpoints
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jiaobendaye/go-claude-code-proxy/conversion"
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+	"github.com/jiaobendaye/go-claude-code-proxy/models"
+	"github.com/jiaobendaye/go-claude-code-proxy/tokens"
+)
+
+// HEADER_ADJUSTED_MAX_TOKENS carries the max_tokens sent upstream when the proxy changed it.
+const HEADER_ADJUSTED_MAX_TOKENS = "X-Adjusted-Max-Tokens"
+
+// contextLengthError reports a prompt that leaves no room for output in the context window of the
+// upstream model, found before sending it.
+type contextLengthError struct {
+	model          string
+	inputTokens    int
+	maxInputTokens int
+}
+
+func (e *contextLengthError) Error() string {
+	// Claude Code looks for this wording to trigger auto-compaction
+	return fmt.Sprintf("prompt is too long: %d tokens > %d maximum", e.inputTokens, e.maxInputTokens)
+}
+
+// prepareRequest checks a request against the upstream model of a route and fits it to the model:
+// image URLs are downloaded for upstreams that can't take them, documents the model can't read
+// turned into text, images described in text for models without vision or else fitted to its size
+// and format limits, a prompt too long for its context window goes through the overflow
+// strategies, and max_tokens is kept within its output limits and what is left of the context
+// window. The request is returned unchanged for passthrough upstreams, which get the client's
+// request as sent.
+func prepareRequest(ctx context.Context, claudeRequest *models.ClaudeMessagesRequest, route core.Route) (*models.ClaudeMessagesRequest, error) {
+	if err := conversion.CheckCapabilities(claudeRequest, route); err != nil {
+		return nil, err
+	}
+	if route.Provider != nil && route.Provider.Type == core.PROVIDER_ANTHROPIC {
+		return claudeRequest, nil
+	}
+	messages, err := inlineURLs(ctx, claudeRequest.Messages, !fetchesImageURLs(route.Provider))
+	if err != nil {
+		return nil, err
+	}
+	if messages, err = conversion.ExtractDocuments(messages, conversion.NativeDocuments(route)); err != nil {
+		return nil, err
+	}
+	profile := core.GetModelManager().ModelProfile(route.Provider, route.Model)
+	if fallback := profile.ImageFallbackMode(core.GetConfig()); fallback == core.IMAGE_FALLBACK_CAPTION || fallback == core.IMAGE_FALLBACK_PLACEHOLDER {
+		messages = replaceImages(ctx, messages, fallback)
+	}
+	if messages, err = conversion.NormalizeImages(messages, profile.ImageLimits()); err != nil {
+		return nil, err
+	}
+	prepared := *claudeRequest
+	prepared.Messages = messages
+	claudeRequest = &prepared
+
+	maxTokens := conversion.ClampMaxTokens(claudeRequest.MaxTokens, route)
+	if profile.ContextWindow > 0 {
+		minTokens, _ := profile.OutputLimits(core.GetConfig())
+		counter := tokens.NewCounter(route)
+		inputTokens := counter.CountInput(claudeRequest.System, claudeRequest.Messages, claudeRequest.Tools)
+		if maxInputTokens := profile.ContextWindow - minTokens; inputTokens > maxInputTokens {
+			claudeRequest, inputTokens, err = fitContextWindow(ctx, claudeRequest, route, profile, counter, inputTokens, maxInputTokens)
+			if err != nil {
+				return nil, err
+			}
+		}
+		maxTokens = min(maxTokens, profile.ContextWindow-inputTokens)
+	}
+	if maxTokens == claudeRequest.MaxTokens {
+		return claudeRequest, nil
+	}
+	adjusted := *claudeRequest
+	adjusted.MaxTokens = maxTokens
+	return &adjusted, nil
+}
+
+// setAdjustedMaxTokens tells the client when the request sent upstream asked for another
+// max_tokens than it did.
+func setAdjustedMaxTokens(c *gin.Context, requested int, sent *models.ClaudeMessagesRequest) {
+	if sent == nil || sent.MaxTokens == requested {
+		return
+	}
+	log.Printf("Adjusted max_tokens from %d to %d for %s", requested, sent.MaxTokens, sent.Model)
+	c.Header(HEADER_ADJUSTED_MAX_TOKENS, fmt.Sprint(sent.MaxTokens))
+}
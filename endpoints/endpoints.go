@@ -7,18 +7,17 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/jiaobendaye/go-claude-code-proxy/conversion"
 	"github.com/jiaobendaye/go-claude-code-proxy/core"
 	"github.com/jiaobendaye/go-claude-code-proxy/models"
-	"github.com/sashabaranov/go-openai"
+	"github.com/jiaobendaye/go-claude-code-proxy/tokens"
 )
 
-var openaiClient *openai.Client
-
 func initClient() {
-	config := core.GetConfig()
-	openaiConfig := openai.DefaultConfig(config.OpenAIAPIKey)
-	openaiConfig.BaseURL = config.OpenAIBaseURL
-	openaiClient = openai.NewClientWithConfig(openaiConfig)
+	for _, provider := range core.GetModelManager().Providers() {
+		providerBackends[provider.Name] = newProviderBackend(provider)
+	}
 }
 
 func ValidateAPI(c *gin.Context) {
@@ -33,8 +32,7 @@ func ValidateAPI(c *gin.Context) {
 	}
 
 	if !config.ValidateClientAPIKey(clientAPIKey) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key. Please provide a valid Anthropic API key."})
-		c.Abort()
+		abortWithError(c, newAnthropicError(http.StatusUnauthorized, ERROR_AUTHENTICATION, "Invalid API key. Please provide a valid Anthropic API key."))
 		return
 	}
 
@@ -46,11 +44,17 @@ func SetupOpenaiClientRouter() *gin.Engine {
 	initClient()
 
 	router := gin.Default()
-	router.Use(ValidateAPI)
+	router.Use(RequestID, ValidateAPI)
+	router.NoRoute(func(c *gin.Context) {
+		abortWithError(c, newAnthropicError(http.StatusNotFound, ERROR_NOT_FOUND, "Not found: "+c.Request.Method+" "+c.Request.URL.Path))
+	})
 
 	// Define routes
 	router.POST("/v1/messages", CreateMessage)
 	router.POST("/v1/messages/count_tokens", CountTokens)
+	router.POST(OPENAI_CHAT_COMPLETIONS_PATH, CreateChatCompletion)
+	router.GET("/v1/models", ListModels)
+	router.GET("/v1/models/:model_id", GetModel)
 	router.GET("/health", HealthCheck)
 	router.GET("/test-connection", TestConnection)
 	router.GET("/", RootEndpoint)
@@ -58,52 +62,50 @@ func SetupOpenaiClientRouter() *gin.Engine {
 	return router
 }
 
-// Placeholder for CountTokens endpoint
+// CountTokens counts input tokens with the tokenizer of the upstream model the request would be routed to,
+// or asks the upstream when it can count tokens itself
 func CountTokens(c *gin.Context) {
-	var claudeReq models.ClaudeMessagesRequest
-	err := c.ShouldBindJSON(&claudeReq)
+	var claudeReq models.ClaudeTokenCountRequest
+	err := c.ShouldBindBodyWith(&claudeReq, binding.JSON)
 	if err != nil {
-		log.Panicf("Error binding JSON: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		log.Printf("Error binding JSON: %v", err)
+		abortWithError(c, newAnthropicError(http.StatusBadRequest, ERROR_INVALID_REQUEST, "Invalid request format: "+err.Error()))
 		return
 	}
-
-	totalChars := 0
-	// Count system message characters
-	if claudeReq.System != nil {
-		if sysStr, ok := claudeReq.System.(string); ok {
-			totalChars += len(sysStr)
-		} else if sysArr, ok := claudeReq.System.([]any); ok {
-			for _, block := range sysArr {
-				if text, valid := core.GetTextField(block); valid {
-					totalChars += len(text)
-				}
-			}
-		}
+	if err := conversion.ValidateContent(claudeReq.Messages); err != nil {
+		abortWithError(c, err)
+		return
 	}
 
-	// Count message characters
-	for _, msg := range claudeReq.Messages {
-		if msg.Content != nil {
-			if msgStr, ok := msg.Content.(string); ok {
-				totalChars += len(msgStr)
-			} else if msgArr, ok := msg.Content.([]any); ok {
-				for _, block := range msgArr {
-					if text, valid := core.GetTextField(block); valid {
-						totalChars += len(text)
-					}
-				}
-			}
+	route := core.GetModelManager().Route(claudeReq.Model)
+	if counter, ok := backendForProvider(route.Provider).(tokenCounter); ok {
+		resp, err := counter.countTokens(withClientRequest(c.Request.Context(), c), &claudeReq, route)
+		if err != nil {
+			log.Printf("Error counting tokens: %v", err)
+			abortWithError(c, err)
+			return
 		}
+		c.JSON(http.StatusOK, resp)
+		return
 	}
-
-	// Rough estimation: 4 characters per token
-	estimatedTokens := totalChars / 4
-	if estimatedTokens == 0 {
-		estimatedTokens = 1
+	// Documents count as the text the model would get, images at the size it would get them
+	ctx := c.Request.Context()
+	messages, err := inlineURLs(ctx, claudeReq.Messages, false)
+	if err == nil {
+		messages, err = conversion.ExtractDocuments(messages, false)
+	}
+	if err == nil {
+		profile := core.GetModelManager().ModelProfile(route.Provider, route.Model)
+		messages, err = conversion.NormalizeImages(messages, profile.ImageLimits())
+	}
+	if err != nil {
+		abortWithError(c, err)
+		return
 	}
+	counter := tokens.NewCounter(route)
+	inputTokens := counter.CountInput(claudeReq.System, messages, claudeReq.Tools)
 
-	c.JSON(http.StatusOK, gin.H{"input_tokens": estimatedTokens})
+	c.JSON(http.StatusOK, gin.H{"input_tokens": inputTokens})
 }
 
 // Placeholder for HealthCheck endpoint
@@ -122,20 +124,18 @@ func HealthCheck(c *gin.Context) {
 func TestConnection(c *gin.Context) {
 	config := core.GetConfig()
 
-	// Simulate OpenAI API call
-	resp, err := openaiClient.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: config.SmallModel,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    "user",
-					Content: "Hello!",
-				},
+	// Send a minimal request to the small model of the default provider
+	route := core.Route{Provider: core.GetModelManager().Provider(core.DEFAULT_PROVIDER), Model: config.SmallModel}
+	resp, err := backendForProvider(route.Provider).createMessage(context.Background(), &models.ClaudeMessagesRequest{
+		Model:     config.SmallModel,
+		MaxTokens: 5,
+		Messages: []models.ClaudeMessage{
+			{
+				Role:    core.ROLE_USER,
+				Content: models.ClaudeContent{models.ClaudeContentBlockText{Type: core.CONTENT_TEXT, Text: "Hello!"}},
 			},
-			MaxTokens: 5,
 		},
-	)
+	}, route)
 
 	if err != nil {
 		log.Printf("ChatCompletion error: %v", err)
@@ -159,7 +159,7 @@ func TestConnection(c *gin.Context) {
 		"message":     "Successfully connected to OpenAI API",
 		"model_used":  config.SmallModel,
 		"timestamp":   time.Now().Format(time.RFC3339),
-		"response_id": resp.ID,
+		"response_id": resp["id"],
 	})
 }
 
@@ -171,6 +171,8 @@ func RootEndpoint(c *gin.Context) {
 		"status":  "running",
 		"config": gin.H{
 			"openai_base_url":           config.OpenAIBaseURL,
+			"azure_api_version":         config.AzureAPIVersion,
+			"routes_config":             config.RoutesConfig,
 			"max_tokens_limit":          config.MaxTokensLimit,
 			"api_key_configured":        config.ValidateAPIKey(),
 			"client_api_key_validation": config.AnthropicAPIKey != "",
@@ -178,10 +180,12 @@ func RootEndpoint(c *gin.Context) {
 			"small_model":               config.SmallModel,
 		},
 		"endpoints": gin.H{
-			"messages":        "/v1/messages",
-			"count_tokens":    "/v1/messages/count_tokens",
-			"health":          "/health",
-			"test_connection": "/test-connection",
+			"messages":         "/v1/messages",
+			"count_tokens":     "/v1/messages/count_tokens",
+			"chat_completions": OPENAI_CHAT_COMPLETIONS_PATH,
+			"models":           "/v1/models",
+			"health":           "/health",
+			"test_connection":  "/test-connection",
 		},
 	})
 }
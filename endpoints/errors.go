@@ -0,0 +1,221 @@
+package endpoints
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jiaobendaye/go-claude-code-proxy/conversion"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Anthropic error types, see https://docs.anthropic.com/en/api/errors
+const (
+	ERROR_INVALID_REQUEST   = "invalid_request_error"
+	ERROR_AUTHENTICATION    = "authentication_error"
+	ERROR_PERMISSION        = "permission_error"
+	ERROR_NOT_FOUND         = "not_found_error"
+	ERROR_REQUEST_TOO_LARGE = "request_too_large"
+	ERROR_RATE_LIMIT        = "rate_limit_error"
+	ERROR_API               = "api_error"
+	ERROR_OVERLOADED        = "overloaded_error"
+
+	STATUS_OVERLOADED = 529
+
+	CONTEXT_REQUEST_ID = "request_id"
+	HEADER_REQUEST_ID  = "request-id"
+)
+
+// AnthropicError is an error in the shape the Anthropic API reports it.
+type AnthropicError struct {
+	Status     int
+	Type       string
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *AnthropicError) Error() string {
+	return fmt.Sprintf("%s (%d): %s", e.Type, e.Status, e.Message)
+}
+
+func newAnthropicError(status int, errType, message string) *AnthropicError {
+	return &AnthropicError{Status: status, Type: errType, Message: message}
+}
+
+// retryAfterError keeps the upstream Retry-After hint of the last failed attempt.
+type retryAfterError struct {
+	err        error
+	retryAfter time.Duration
+}
+
+func (e *retryAfterError) Error() string { return e.err.Error() }
+func (e *retryAfterError) Unwrap() error { return e.err }
+
+func withRetryAfter(err error, retryAfter time.Duration) error {
+	if err == nil || retryAfter <= 0 {
+		return err
+	}
+	return &retryAfterError{err: err, retryAfter: retryAfter}
+}
+
+// errorTypeForStatus maps an upstream HTTP status to the Anthropic error type and status.
+func errorTypeForStatus(status int) (int, string) {
+	switch {
+	case status == http.StatusBadRequest, status == http.StatusUnprocessableEntity:
+		return http.StatusBadRequest, ERROR_INVALID_REQUEST
+	case status == http.StatusUnauthorized:
+		return http.StatusUnauthorized, ERROR_AUTHENTICATION
+	case status == http.StatusForbidden:
+		return http.StatusForbidden, ERROR_PERMISSION
+	case status == http.StatusNotFound:
+		return http.StatusNotFound, ERROR_NOT_FOUND
+	case status == http.StatusRequestEntityTooLarge:
+		return http.StatusRequestEntityTooLarge, ERROR_REQUEST_TOO_LARGE
+	case status == http.StatusTooManyRequests:
+		return http.StatusTooManyRequests, ERROR_RATE_LIMIT
+	case status == http.StatusServiceUnavailable, status == STATUS_OVERLOADED:
+		return STATUS_OVERLOADED, ERROR_OVERLOADED
+	case status >= 400 && status < 500:
+		return http.StatusBadRequest, ERROR_INVALID_REQUEST
+	}
+	return http.StatusInternalServerError, ERROR_API
+}
+
+// statusForErrorType maps an Anthropic error type back to the HTTP status Anthropic uses for it,
+// for errors reported inside a stream.
+func statusForErrorType(errType string) int {
+	switch errType {
+	case ERROR_INVALID_REQUEST:
+		return http.StatusBadRequest
+	case ERROR_AUTHENTICATION:
+		return http.StatusUnauthorized
+	case ERROR_PERMISSION:
+		return http.StatusForbidden
+	case ERROR_NOT_FOUND:
+		return http.StatusNotFound
+	case ERROR_REQUEST_TOO_LARGE:
+		return http.StatusRequestEntityTooLarge
+	case ERROR_RATE_LIMIT:
+		return http.StatusTooManyRequests
+	case ERROR_OVERLOADED:
+		return STATUS_OVERLOADED
+	}
+	return http.StatusInternalServerError
+}
+
+// translateError converts any error of the request pipeline into an AnthropicError.
+func translateError(err error) *AnthropicError {
+	var anthropicErr *AnthropicError
+	if errors.As(err, &anthropicErr) {
+		return anthropicErr
+	}
+
+	var translated *AnthropicError
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	var capabilityErr *conversion.CapabilityError
+	var contentErr *conversion.ContentError
+	switch {
+	case errors.As(err, &capabilityErr):
+		translated = newAnthropicError(http.StatusBadRequest, ERROR_INVALID_REQUEST, capabilityErr.Error())
+	case errors.As(err, &contentErr):
+		translated = newAnthropicError(http.StatusBadRequest, ERROR_INVALID_REQUEST, contentErr.Error())
+	case isContextLengthError(err):
+		// Claude Code looks for this wording to trigger auto-compaction
+		message := upstreamMessage(err)
+		if !strings.HasPrefix(message, "prompt is too long") {
+			message = "prompt is too long: " + message
+		}
+		translated = newAnthropicError(http.StatusBadRequest, ERROR_INVALID_REQUEST, message)
+	case errors.As(err, &apiErr) && apiErr.HTTPStatusCode != 0:
+		status, errType := errorTypeForStatus(apiErr.HTTPStatusCode)
+		translated = newAnthropicError(status, errType, apiErr.Message)
+	case errors.As(err, &reqErr) && reqErr.HTTPStatusCode != 0:
+		status, errType := errorTypeForStatus(reqErr.HTTPStatusCode)
+		translated = newAnthropicError(status, errType, upstreamMessage(err))
+	case errors.Is(err, context.DeadlineExceeded):
+		translated = newAnthropicError(http.StatusGatewayTimeout, ERROR_API, "Upstream request timed out")
+	default:
+		translated = newAnthropicError(http.StatusInternalServerError, ERROR_API, upstreamMessage(err))
+	}
+
+	var hinted *retryAfterError
+	if errors.As(err, &hinted) {
+		translated.RetryAfter = hinted.retryAfter
+	}
+	return translated
+}
+
+// upstreamMessage extracts the most useful message of an upstream error.
+func upstreamMessage(err error) string {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Message
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		if body := strings.TrimSpace(string(reqErr.Body)); body != "" {
+			return body
+		}
+		if reqErr.Err != nil {
+			return reqErr.Err.Error()
+		}
+	}
+	return err.Error()
+}
+
+// errorBody renders the Anthropic error envelope.
+func errorBody(c *gin.Context, anthropicErr *AnthropicError) gin.H {
+	return gin.H{
+		"type": "error",
+		"error": gin.H{
+			"type":    anthropicErr.Type,
+			"message": anthropicErr.Message,
+		},
+		"request_id": c.GetString(CONTEXT_REQUEST_ID),
+	}
+}
+
+// openaiErrorBody renders the OpenAI error envelope, for the chat completions endpoint.
+func openaiErrorBody(anthropicErr *AnthropicError) gin.H {
+	return gin.H{
+		"error": gin.H{
+			"message": anthropicErr.Message,
+			"type":    anthropicErr.Type,
+			"param":   nil,
+			"code":    nil,
+		},
+	}
+}
+
+// abortWithError writes err as an Anthropic error response, or as an OpenAI one to OpenAI clients.
+func abortWithError(c *gin.Context, err error) {
+	anthropicErr := translateError(err)
+	if anthropicErr.RetryAfter > 0 {
+		c.Header("retry-after", strconv.Itoa(int((anthropicErr.RetryAfter+time.Second-1)/time.Second)))
+	}
+	if c.FullPath() == OPENAI_CHAT_COMPLETIONS_PATH {
+		// 529 is Anthropic's own status, OpenAI clients know 503
+		status := anthropicErr.Status
+		if status == STATUS_OVERLOADED {
+			status = http.StatusServiceUnavailable
+		}
+		c.AbortWithStatusJSON(status, openaiErrorBody(anthropicErr))
+		return
+	}
+	c.AbortWithStatusJSON(anthropicErr.Status, errorBody(c, anthropicErr))
+}
+
+// RequestID assigns every request an id, returned in the request-id header and error bodies.
+func RequestID(c *gin.Context) {
+	requestID := "req_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+	c.Set(CONTEXT_REQUEST_ID, requestID)
+	c.Header(HEADER_REQUEST_ID, requestID)
+	c.Next()
+}
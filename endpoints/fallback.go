@@ -0,0 +1,90 @@
+package endpoints
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jiaobendaye/go-claude-code-proxy/conversion"
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	HEADER_UPSTREAM_PROVIDER = "X-Upstream-Provider"
+	HEADER_UPSTREAM_MODEL    = "X-Upstream-Model"
+)
+
+// isContextLengthError detects prompts exceeding the model's context window, found by the proxy
+// or rejected by the upstream.
+func isContextLengthError(err error) bool {
+	var contextErr *contextLengthError
+	if errors.As(err, &contextErr) {
+		return true
+	}
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if code, ok := apiErr.Code.(string); ok && code == "context_length_exceeded" {
+		return true
+	}
+	message := strings.ToLower(apiErr.Message)
+	return strings.Contains(message, "context length") ||
+		strings.Contains(message, "context window") ||
+		strings.Contains(message, "maximum context") ||
+		strings.Contains(message, "prompt is too long") ||
+		strings.Contains(message, "exceeds the maximum number of tokens")
+}
+
+// shouldFallback reports whether a failed upstream call may be retried on the next fallback model.
+func shouldFallback(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if isContextLengthError(err) {
+		return true
+	}
+	var capabilityErr *conversion.CapabilityError
+	if errors.As(err, &capabilityErr) {
+		// A fallback model may support what the request needs
+		return true
+	}
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) && apiErr.HTTPStatusCode == 0 {
+		// Errors reported inside a stream carry no status code
+		return false
+	}
+	return isRetryableError(ctx, err)
+}
+
+// setServedBy records which provider and model served the request.
+func setServedBy(c *gin.Context, route core.Route) {
+	c.Header(HEADER_UPSTREAM_PROVIDER, route.Provider.Name)
+	c.Header(HEADER_UPSTREAM_MODEL, route.Model)
+}
+
+// callWithFallbacks runs call for the route and then each of its fallbacks until one succeeds
+// or fails with an error that does not warrant a fallback. It returns the candidate that served.
+func callWithFallbacks[T any](ctx context.Context, requestedModel string, route core.Route, call func(candidate core.Route) (T, error)) (T, core.Route, error) {
+	var result T
+	var err error
+	var candidate core.Route
+	for i, next := range route.Candidates() {
+		candidate = next
+		if i > 0 {
+			log.Printf("Falling back to %s on provider %s after error: %v", candidate.Model, candidate.Provider.Name, err)
+		}
+		result, err = call(candidate)
+		if err == nil {
+			log.Printf("Model %s served by %s on provider %s", requestedModel, candidate.Model, candidate.Provider.Name)
+			return result, candidate, nil
+		}
+		if !shouldFallback(ctx, err) {
+			break
+		}
+	}
+	return result, candidate, err
+}
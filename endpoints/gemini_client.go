@@ -0,0 +1,84 @@
+package endpoints
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+	"github.com/jiaobendaye/go-claude-code-proxy/models"
+	"github.com/sashabaranov/go-openai"
+)
+
+// geminiClient calls the Gemini generateContent API. Like responsesClient, failures are reported
+// as go-openai errors.
+type geminiClient struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+func newGeminiClient(provider *core.ProviderConfig) *geminiClient {
+	return &geminiClient{
+		baseURL:    strings.TrimSuffix(provider.BaseURL, "/"),
+		apiKey:     provider.APIKey,
+		httpClient: newProviderHTTPClient(provider),
+	}
+}
+
+func (c *geminiClient) post(ctx context.Context, model string, req *models.GeminiRequest, stream bool) (*http.Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := c.baseURL + "/models/" + url.PathEscape(model) + ":generateContent"
+	if stream {
+		endpoint = c.baseURL + "/models/" + url.PathEscape(model) + ":streamGenerateContent?alt=sse"
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-goog-api-key", c.apiKey)
+	if stream {
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		return nil, decodeUpstreamError(resp)
+	}
+	return resp, nil
+}
+
+func (c *geminiClient) generate(ctx context.Context, model string, req *models.GeminiRequest) (models.GeminiResponse, error) {
+	var response models.GeminiResponse
+	resp, err := c.post(ctx, model, req, false)
+	if err != nil {
+		return response, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return response, err
+	}
+	if response.Error != nil {
+		return response, &openai.APIError{Code: response.Error.Code, Type: response.Error.Status, Message: response.Error.Message, HTTPStatusCode: http.StatusInternalServerError}
+	}
+	return response, nil
+}
+
+func (c *geminiClient) generateStream(ctx context.Context, model string, req *models.GeminiRequest) (*sseStream[models.GeminiResponse], error) {
+	resp, err := c.post(ctx, model, req, true)
+	if err != nil {
+		return nil, err
+	}
+	return newSSEStream[models.GeminiResponse](resp.Body), nil
+}
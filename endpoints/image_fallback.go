@@ -0,0 +1,164 @@
+package endpoints
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+	"github.com/jiaobendaye/go-claude-code-proxy/models"
+)
+
+const (
+	// IMAGE_CAPTION_MAX_TOKENS is the output limit of an image description
+	IMAGE_CAPTION_MAX_TOKENS = 1024
+	// IMAGE_CAPTION_CACHE_SIZE is how many image descriptions are kept, the oldest are dropped first
+	IMAGE_CAPTION_CACHE_SIZE = 512
+
+	imageCaptionPrompt = "You describe images for an AI coding assistant that can't see them. Transcribe all text, code, " +
+		"error messages and numbers in the image exactly, then describe its layout, UI elements, diagrams or charts, and " +
+		"anything else needed to act on it. Be concise and factual, don't guess at what isn't visible."
+	imageCaptionHeader = "[Image described by the proxy, the model does not accept images]\n"
+	imageCaptionFooter = "\n[End of image description]"
+	imagePlaceholder   = "[image omitted: the model does not accept images]"
+)
+
+// captionCache keeps image descriptions by image hash, so images sent again with every turn of a
+// conversation are only described once.
+var captionCache = struct {
+	sync.Mutex
+	captions map[string]string
+	order    []string
+}{captions: map[string]string{}}
+
+// replaceImages replaces the images of the messages, including those returned by tools, with text
+// for models without vision: a description written by the VISION_MODEL in caption mode, a
+// placeholder otherwise or when describing fails.
+// The messages themselves are returned when they have no image.
+func replaceImages(ctx context.Context, messages []models.ClaudeMessage, fallback string) []models.ClaudeMessage {
+	var replaced []models.ClaudeMessage
+	for i, msg := range messages {
+		content, changed := replaceImageContent(ctx, msg.Content, fallback)
+		if !changed {
+			continue
+		}
+		if replaced == nil {
+			replaced = append([]models.ClaudeMessage(nil), messages...)
+		}
+		replaced[i] = models.ClaudeMessage{Role: msg.Role, Content: content}
+	}
+	if replaced == nil {
+		return messages
+	}
+	return replaced
+}
+
+func replaceImageContent(ctx context.Context, content models.ClaudeContent, fallback string) (models.ClaudeContent, bool) {
+	replaced := models.ClaudeContent{}
+	changed := false
+	for _, block := range content {
+		switch block := block.(type) {
+		case models.ClaudeContentBlockImage:
+			replaced = append(replaced, models.ClaudeContentBlockText{Type: core.CONTENT_TEXT, Text: imageText(ctx, block.Source, fallback)})
+			changed = true
+			continue
+		case models.ClaudeContentBlockToolResult:
+			items, itemsChanged := replaceImageContent(ctx, block.Content, fallback)
+			if itemsChanged {
+				block.Content = items
+				replaced = append(replaced, block)
+				changed = true
+				continue
+			}
+		}
+		replaced = append(replaced, block)
+	}
+	return replaced, changed
+}
+
+// imageText returns the text an image is replaced with.
+func imageText(ctx context.Context, source models.ClaudeImageSource, fallback string) string {
+	if fallback != core.IMAGE_FALLBACK_CAPTION {
+		return imagePlaceholder
+	}
+	caption, err := captionImage(ctx, source)
+	if err != nil {
+		log.Printf("Failed to describe an image, leaving a placeholder: %v", err)
+		return imagePlaceholder
+	}
+	return imageCaptionHeader + caption + imageCaptionFooter
+}
+
+// captionImage returns the description of an image, asking the VISION_MODEL unless it is cached.
+func captionImage(ctx context.Context, source models.ClaudeImageSource) (string, error) {
+	key := imageHash(source)
+	captionCache.Lock()
+	caption, ok := captionCache.captions[key]
+	captionCache.Unlock()
+	if ok {
+		return caption, nil
+	}
+
+	config := core.GetConfig()
+	if config.VisionModel == "" {
+		return "", fmt.Errorf("VISION_MODEL is not set")
+	}
+	manager := core.GetModelManager()
+	route := manager.Route(config.VisionModel)
+	// Its images would otherwise be described by itself
+	if manager.ModelProfile(route.Provider, route.Model).ImageFallbackMode(config) != "" {
+		return "", fmt.Errorf("VISION_MODEL %s does not accept images", route.Model)
+	}
+	resp, _, err := createMessage(ctx, &models.ClaudeMessagesRequest{
+		Model:     config.VisionModel,
+		MaxTokens: IMAGE_CAPTION_MAX_TOKENS,
+		System:    models.ClaudeContent{models.ClaudeContentBlockText{Type: core.CONTENT_TEXT, Text: imageCaptionPrompt}},
+		Messages: []models.ClaudeMessage{{
+			Role: core.ROLE_USER,
+			Content: models.ClaudeContent{
+				models.ClaudeContentBlockImage{Type: core.CONTENT_IMAGE, Source: source},
+				models.ClaudeContentBlockText{Type: core.CONTENT_TEXT, Text: "Describe this image."},
+			},
+		}},
+	}, route)
+	if err != nil {
+		return "", err
+	}
+	caption, err = responseText(resp)
+	if err != nil {
+		return "", err
+	}
+	if caption == "" {
+		return "", fmt.Errorf("the description of %s is empty", route.Model)
+	}
+
+	captionCache.Lock()
+	defer captionCache.Unlock()
+	if _, ok := captionCache.captions[key]; !ok {
+		if len(captionCache.order) >= IMAGE_CAPTION_CACHE_SIZE {
+			delete(captionCache.captions, captionCache.order[0])
+			captionCache.order = captionCache.order[1:]
+		}
+		captionCache.captions[key] = caption
+		captionCache.order = append(captionCache.order, key)
+	}
+	return caption, nil
+}
+
+// imageHash identifies an image by its data, or by its URL or file id.
+func imageHash(source models.ClaudeImageSource) string {
+	hash := sha256.New()
+	hash.Write([]byte(source.Type + "\n"))
+	switch source.Type {
+	case core.SOURCE_BASE64:
+		hash.Write([]byte(source.Data))
+	case core.SOURCE_URL:
+		hash.Write([]byte(source.URL))
+	case core.SOURCE_FILE:
+		hash.Write([]byte(source.FileID))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,207 @@
+package endpoints
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+	"github.com/jiaobendaye/go-claude-code-proxy/models"
+)
+
+const (
+	MODELS_DEFAULT_LIMIT = 20
+	MODELS_MAX_LIMIT     = 1000
+)
+
+// modelDateSuffix matches the release date Claude model ids end with.
+var modelDateSuffix = regexp.MustCompile(`-(\d{8})$`)
+
+// ListModels lists the models clients can ask for, in the shape of the Anthropic models API with
+// its before_id, after_id and limit pagination. Every alias of the routing configuration is listed
+// with the upstream model it is routed to, followed by the models installed on providers that can
+// enumerate them and that requests for them are routed to. A provider that can't be reached is
+// logged and left out.
+func ListModels(c *gin.Context) {
+	limit := MODELS_DEFAULT_LIMIT
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > MODELS_MAX_LIMIT {
+			abortWithError(c, newAnthropicError(http.StatusBadRequest, ERROR_INVALID_REQUEST, "limit: must be between 1 and 1000"))
+			return
+		}
+		limit = parsed
+	}
+	beforeID, afterID := c.Query("before_id"), c.Query("after_id")
+	if beforeID != "" && afterID != "" {
+		abortWithError(c, newAnthropicError(http.StatusBadRequest, ERROR_INVALID_REQUEST, "before_id and after_id cannot both be set"))
+		return
+	}
+
+	data := listModelInfos(c.Request.Context())
+	start, end := 0, len(data)
+	switch {
+	case afterID != "":
+		index := modelIndex(data, afterID)
+		if index < 0 {
+			abortWithError(c, newAnthropicError(http.StatusBadRequest, ERROR_INVALID_REQUEST, "after_id: unknown model "+afterID))
+			return
+		}
+		start = index + 1
+		end = min(start+limit, len(data))
+	case beforeID != "":
+		index := modelIndex(data, beforeID)
+		if index < 0 {
+			abortWithError(c, newAnthropicError(http.StatusBadRequest, ERROR_INVALID_REQUEST, "before_id: unknown model "+beforeID))
+			return
+		}
+		end = index
+		start = max(end-limit, 0)
+	default:
+		end = min(limit, len(data))
+	}
+	page := data[start:end]
+
+	// has_more looks in the direction of the pagination
+	hasMore := end < len(data)
+	if beforeID != "" {
+		hasMore = start > 0
+	}
+	response := gin.H{"data": page, "has_more": hasMore, "first_id": nil, "last_id": nil}
+	if len(page) > 0 {
+		response["first_id"] = page[0].ID
+		response["last_id"] = page[len(page)-1].ID
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetModel describes one model. Aliases and models a routing rule matches are described by their
+// route without asking the providers; other models are found among those installed on the
+// provider they would be routed to.
+func GetModel(c *gin.Context) {
+	id := c.Param("model_id")
+	manager := core.GetModelManager()
+	if manager.HasRoute(id) || slices.Contains(manager.Aliases(), id) {
+		c.JSON(http.StatusOK, aliasModelInfo(id))
+		return
+	}
+	data := installedModelInfos(c.Request.Context(), manager.Route(id).Provider)
+	if index := modelIndex(data, id); index >= 0 {
+		c.JSON(http.StatusOK, data[index])
+		return
+	}
+	abortWithError(c, newAnthropicError(http.StatusNotFound, ERROR_NOT_FOUND, "model: "+id))
+}
+
+// listModelInfos collects the routed aliases and the models installed on providers.
+func listModelInfos(ctx context.Context) []models.ClaudeModelInfo {
+	manager := core.GetModelManager()
+	data := []models.ClaudeModelInfo{}
+	seen := map[string]bool{}
+	for _, alias := range manager.Aliases() {
+		seen[alias] = true
+		data = append(data, aliasModelInfo(alias))
+	}
+
+	for _, provider := range manager.Providers() {
+		for _, modelInfo := range installedModelInfos(ctx, provider) {
+			if !seen[modelInfo.ID] {
+				seen[modelInfo.ID] = true
+				data = append(data, modelInfo)
+			}
+		}
+	}
+	return data
+}
+
+// installedModelInfos lists the models installed on a provider that requests for their id are
+// routed to, so that asking for a listed model reaches it. Installed models routed elsewhere are
+// left out.
+func installedModelInfos(ctx context.Context, provider *core.ProviderConfig) []models.ClaudeModelInfo {
+	lister, ok := backendForProvider(provider).(modelLister)
+	if !ok {
+		return nil
+	}
+	modelInfos, err := lister.listModels(ctx)
+	if err != nil {
+		log.Printf("Listing models of provider %s failed: %v", provider.Name, err)
+		return nil
+	}
+	manager := core.GetModelManager()
+	installed := []models.ClaudeModelInfo{}
+	for _, modelInfo := range modelInfos {
+		route := manager.Route(modelInfo.ID)
+		if route.Provider.Name != provider.Name {
+			continue
+		}
+		capabilities := manager.ModelProfile(route.Provider, route.Model).Capabilities()
+		modelInfo.Upstream = &models.ClaudeModelUpstream{Provider: route.Provider.Name, Model: route.Model}
+		modelInfo.Capabilities = &capabilities
+		installed = append(installed, modelInfo)
+	}
+	return installed
+}
+
+// aliasModelInfo describes a model name by the route it takes.
+func aliasModelInfo(alias string) models.ClaudeModelInfo {
+	manager := core.GetModelManager()
+	route := manager.Route(alias)
+	capabilities := manager.ModelProfile(route.Provider, route.Model).Capabilities()
+	return models.ClaudeModelInfo{
+		Type:         "model",
+		ID:           alias,
+		DisplayName:  modelDisplayName(alias),
+		CreatedAt:    modelCreatedAt(alias),
+		Upstream:     &models.ClaudeModelUpstream{Provider: route.Provider.Name, Model: route.Model},
+		Capabilities: &capabilities,
+	}
+}
+
+func modelIndex(data []models.ClaudeModelInfo, id string) int {
+	for i, modelInfo := range data {
+		if modelInfo.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// modelDisplayName turns a model id like claude-3-5-haiku-20241022 into "Claude 3.5 Haiku".
+func modelDisplayName(id string) string {
+	words := []string{}
+	for _, part := range strings.Split(modelDateSuffix.ReplaceAllString(id, ""), "-") {
+		if part == "" {
+			continue
+		}
+		last := len(words) - 1
+		if _, err := strconv.Atoi(part); err == nil && last >= 0 && isVersion(words[last]) {
+			// Consecutive numbers form a version
+			words[last] += "." + part
+			continue
+		}
+		words = append(words, strings.ToUpper(part[:1])+part[1:])
+	}
+	return strings.Join(words, " ")
+}
+
+func isVersion(word string) bool {
+	_, err := strconv.ParseFloat(word, 64)
+	return err == nil
+}
+
+// modelCreatedAt dates a model by the release date in its id, or the Unix epoch without one.
+func modelCreatedAt(id string) string {
+	created := time.Unix(0, 0).UTC()
+	if match := modelDateSuffix.FindStringSubmatch(id); match != nil {
+		if date, err := time.Parse("20060102", match[1]); err == nil {
+			created = date
+		}
+	}
+	return created.Format(time.RFC3339)
+}
@@ -0,0 +1,92 @@
+package endpoints
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+	"github.com/jiaobendaye/go-claude-code-proxy/models"
+)
+
+// ollamaClient calls the native Ollama API. Like responsesClient, failures are reported as
+// go-openai errors. Local Ollama needs no key; one is sent as bearer token when configured, for
+// instances behind an authenticating reverse proxy.
+type ollamaClient struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+func newOllamaClient(provider *core.ProviderConfig) *ollamaClient {
+	return &ollamaClient{
+		baseURL:    strings.TrimSuffix(provider.BaseURL, "/"),
+		apiKey:     provider.APIKey,
+		httpClient: newProviderHTTPClient(provider),
+	}
+}
+
+func (c *ollamaClient) do(ctx context.Context, method, path string, payload any) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(encoded)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		return nil, decodeUpstreamError(resp)
+	}
+	return resp, nil
+}
+
+func (c *ollamaClient) chat(ctx context.Context, req *models.OllamaChatRequest) (models.OllamaChatResponse, error) {
+	var response models.OllamaChatResponse
+	resp, err := c.do(ctx, http.MethodPost, "/api/chat", req)
+	if err != nil {
+		return response, err
+	}
+	defer resp.Body.Close()
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func (c *ollamaClient) chatStream(ctx context.Context, req *models.OllamaChatRequest) (*ndjsonStream[models.OllamaChatResponse], error) {
+	resp, err := c.do(ctx, http.MethodPost, "/api/chat", req)
+	if err != nil {
+		return nil, err
+	}
+	return newNDJSONStream[models.OllamaChatResponse](resp.Body), nil
+}
+
+// tags lists the locally installed models.
+func (c *ollamaClient) tags(ctx context.Context) (models.OllamaTagsResponse, error) {
+	var response models.OllamaTagsResponse
+	resp, err := c.do(ctx, http.MethodGet, "/api/tags", nil)
+	if err != nil {
+		return response, err
+	}
+	defer resp.Body.Close()
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
@@ -0,0 +1,263 @@
+package endpoints
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+	"github.com/jiaobendaye/go-claude-code-proxy/models"
+	"github.com/jiaobendaye/go-claude-code-proxy/tokens"
+)
+
+const (
+	// Tool outputs above OVERFLOW_TRUNCATE_TOKENS are cut to their first and last OVERFLOW_TRUNCATE_KEEP_CHARS characters
+	OVERFLOW_TRUNCATE_TOKENS     = 1000
+	OVERFLOW_TRUNCATE_KEEP_CHARS = 2000
+
+	// OVERFLOW_SUMMARY_MAX_TOKENS is the output limit of the summary, which is also left free when
+	// choosing the turns to summarize
+	OVERFLOW_SUMMARY_MAX_TOKENS = 2048
+
+	overflowDroppedMarker = "[tool output removed by the proxy to fit the context window]"
+	overflowSummaryPrompt = "You compress conversations between a user and an AI coding assistant. Summarize the " +
+		"conversation below so the assistant can continue the work without it: the user's goals and instructions, " +
+		"decisions made, files and code touched, tool results that still matter, and open tasks. Be concise and factual."
+	overflowSummaryHeader = "Summary of the earlier conversation, written by the proxy to fit the context window:\n\n"
+)
+
+// overflowStrategy shrinks a request whose prompt is excess tokens too long for the context window.
+// It returns a shrunk copy, leaving the request itself unchanged since fallbacks reuse it.
+type overflowStrategy func(ctx context.Context, claudeRequest *models.ClaudeMessagesRequest, excess int, counter *tokens.Counter) (*models.ClaudeMessagesRequest, error)
+
+var overflowStrategies = map[string]overflowStrategy{
+	core.OVERFLOW_TRUNCATE_TOOL_RESULTS: truncateToolResults,
+	core.OVERFLOW_DROP_TOOL_RESULTS:     dropToolResults,
+	core.OVERFLOW_SUMMARIZE:             summarizeOlderTurns,
+}
+
+// fitContextWindow applies the overflow strategies of the model in order until the prompt has no
+// more than maxInputTokens tokens. It returns the shrunk request and its prompt tokens, or a
+// contextLengthError once a strategy says reject or none is left.
+func fitContextWindow(ctx context.Context, claudeRequest *models.ClaudeMessagesRequest, route core.Route, profile core.ModelProfile, counter *tokens.Counter, inputTokens, maxInputTokens int) (*models.ClaudeMessagesRequest, int, error) {
+	strategies := profile.ContextOverflow
+	if strategies == nil {
+		strategies = core.GetConfig().ContextOverflow
+	}
+	for _, name := range strategies {
+		if name == core.OVERFLOW_REJECT {
+			break
+		}
+		shrunk, err := overflowStrategies[name](ctx, claudeRequest, inputTokens-maxInputTokens, counter)
+		if err != nil {
+			log.Printf("Context overflow strategy %s failed for %s: %v", name, route.Model, err)
+			continue
+		}
+		shrunkTokens := counter.CountInput(shrunk.System, shrunk.Messages, shrunk.Tools)
+		log.Printf("Context overflow strategy %s shrank the prompt for %s from %d to %d tokens, %d fit", name, route.Model, inputTokens, shrunkTokens, maxInputTokens)
+		claudeRequest, inputTokens = shrunk, shrunkTokens
+		if inputTokens <= maxInputTokens {
+			return claudeRequest, inputTokens, nil
+		}
+	}
+	return nil, 0, &contextLengthError{model: route.Model, inputTokens: inputTokens, maxInputTokens: maxInputTokens}
+}
+
+// rewriteToolResults copies the request with the tool results of all but the last message passed
+// through rewrite, oldest first, until the rewrites saved excess tokens. The last message holds the
+// results the model is about to act on and stays as it is.
+func rewriteToolResults(claudeRequest *models.ClaudeMessagesRequest, excess int, counter *tokens.Counter, rewrite func(models.ClaudeContent) (models.ClaudeContent, bool)) (*models.ClaudeMessagesRequest, error) {
+	shrunk := *claudeRequest
+	shrunk.Messages = append([]models.ClaudeMessage(nil), claudeRequest.Messages...)
+	saved := 0
+	changed := false
+	for i := 0; i < len(shrunk.Messages)-1 && saved < excess; i++ {
+		msg := shrunk.Messages[i]
+		if !core.HasBlockType(msg.Content, core.CONTENT_TOOL_RESULT) {
+			continue
+		}
+		content := append(models.ClaudeContent(nil), msg.Content...)
+		for j, block := range content {
+			toolResult, ok := block.(models.ClaudeContentBlockToolResult)
+			if !ok {
+				continue
+			}
+			rewritten, ok := rewrite(toolResult.Content)
+			if !ok {
+				continue
+			}
+			before := counter.CountInput(nil, []models.ClaudeMessage{{Role: msg.Role, Content: toolResult.Content}}, nil)
+			after := counter.CountInput(nil, []models.ClaudeMessage{{Role: msg.Role, Content: rewritten}}, nil)
+			toolResult.Content = rewritten
+			content[j] = toolResult
+			saved += before - after
+			changed = true
+			if saved >= excess {
+				break
+			}
+		}
+		shrunk.Messages[i] = models.ClaudeMessage{Role: msg.Role, Content: content}
+	}
+	if !changed {
+		return nil, fmt.Errorf("no earlier tool results to shrink")
+	}
+	return &shrunk, nil
+}
+
+// truncateToolResults cuts large tool outputs to their start and end, with a marker in between.
+func truncateToolResults(_ context.Context, claudeRequest *models.ClaudeMessagesRequest, excess int, counter *tokens.Counter) (*models.ClaudeMessagesRequest, error) {
+	return rewriteToolResults(claudeRequest, excess, counter, func(content models.ClaudeContent) (models.ClaudeContent, bool) {
+		truncated := models.ClaudeContent{}
+		changed := false
+		for _, block := range content {
+			text, ok := block.(models.ClaudeContentBlockText)
+			runes := []rune(text.Text)
+			if !ok || len(runes) <= 2*OVERFLOW_TRUNCATE_KEEP_CHARS || counter.Text(text.Text) <= OVERFLOW_TRUNCATE_TOKENS {
+				truncated = append(truncated, block)
+				continue
+			}
+			removed := string(runes[OVERFLOW_TRUNCATE_KEEP_CHARS : len(runes)-OVERFLOW_TRUNCATE_KEEP_CHARS])
+			text.Text = string(runes[:OVERFLOW_TRUNCATE_KEEP_CHARS]) +
+				fmt.Sprintf("\n\n[... %d tokens of tool output truncated by the proxy to fit the context window ...]\n\n", counter.Text(removed)) +
+				string(runes[len(runes)-OVERFLOW_TRUNCATE_KEEP_CHARS:])
+			truncated = append(truncated, text)
+			changed = true
+		}
+		return truncated, changed
+	})
+}
+
+// dropToolResults replaces the outputs of the oldest tool calls with a marker. The tool_result
+// blocks stay, every tool call still needs its result.
+func dropToolResults(_ context.Context, claudeRequest *models.ClaudeMessagesRequest, excess int, counter *tokens.Counter) (*models.ClaudeMessagesRequest, error) {
+	return rewriteToolResults(claudeRequest, excess, counter, func(content models.ClaudeContent) (models.ClaudeContent, bool) {
+		if len(content) == 1 {
+			if text, ok := content[0].(models.ClaudeContentBlockText); ok && text.Text == overflowDroppedMarker {
+				return nil, false
+			}
+		}
+		return models.ClaudeContent{models.ClaudeContentBlockText{Type: core.CONTENT_TEXT, Text: overflowDroppedMarker}}, true
+	})
+}
+
+// summarizeOlderTurns replaces the oldest turns with a summary written by the small model. The
+// summarized turns end before a user message without tool results, so no tool call loses its
+// result, and hold enough tokens to make room for the summary; all turns before the last such
+// message if none does.
+func summarizeOlderTurns(ctx context.Context, claudeRequest *models.ClaudeMessagesRequest, excess int, counter *tokens.Counter) (*models.ClaudeMessagesRequest, error) {
+	messages := claudeRequest.Messages
+	split := 0
+	olderTokens := 0
+	for i := 1; i < len(messages); i++ {
+		olderTokens += counter.CountInput(nil, messages[i-1:i], nil)
+		msg := messages[i]
+		if msg.Role == core.ROLE_USER && !core.HasBlockType(msg.Content, core.CONTENT_TOOL_RESULT) {
+			split = i
+			if olderTokens >= excess+OVERFLOW_SUMMARY_MAX_TOKENS {
+				break
+			}
+		}
+	}
+	if split == 0 {
+		return nil, fmt.Errorf("no earlier turns to summarize")
+	}
+
+	summary, err := summarize(ctx, messages[:split])
+	if err != nil {
+		return nil, err
+	}
+	first := messages[split]
+	content := models.ClaudeContent{models.ClaudeContentBlockText{Type: core.CONTENT_TEXT, Text: overflowSummaryHeader + summary}}
+	content = append(content, first.Content...)
+
+	shrunk := *claudeRequest
+	shrunk.Messages = append([]models.ClaudeMessage{{Role: core.ROLE_USER, Content: content}}, messages[split+1:]...)
+	return &shrunk, nil
+}
+
+// summarize asks the small model for a summary of the messages. A transcript larger than the
+// small model's context window loses its oldest part.
+func summarize(ctx context.Context, messages []models.ClaudeMessage) (string, error) {
+	config := core.GetConfig()
+	manager := core.GetModelManager()
+	route := manager.Route(config.SmallModel)
+
+	transcript := renderTranscript(messages)
+	if window := manager.ModelProfile(route.Provider, route.Model).ContextWindow; window > 0 {
+		counter := tokens.NewCounter(route)
+		room := window - OVERFLOW_SUMMARY_MAX_TOKENS - counter.Text(overflowSummaryPrompt) - 100
+		if transcriptTokens := counter.Text(transcript); transcriptTokens > room && room > 0 {
+			runes := []rune(transcript)
+			transcript = string(runes[len(runes)-len(runes)*room/transcriptTokens:])
+		}
+	}
+
+	resp, err := backendForProvider(route.Provider).createMessage(ctx, &models.ClaudeMessagesRequest{
+		Model:     config.SmallModel,
+		MaxTokens: OVERFLOW_SUMMARY_MAX_TOKENS,
+		System:    models.ClaudeContent{models.ClaudeContentBlockText{Type: core.CONTENT_TEXT, Text: overflowSummaryPrompt}},
+		Messages: []models.ClaudeMessage{{
+			Role:    core.ROLE_USER,
+			Content: models.ClaudeContent{models.ClaudeContentBlockText{Type: core.CONTENT_TEXT, Text: transcript}},
+		}},
+	}, route)
+	if err != nil {
+		return "", err
+	}
+	summary, err := responseText(resp)
+	if err != nil {
+		return "", err
+	}
+	if summary == "" {
+		return "", fmt.Errorf("the summary of %s is empty", route.Model)
+	}
+	return summary, nil
+}
+
+// responseText returns the text of a Claude response written by the proxy's own requests.
+func responseText(resp map[string]any) (string, error) {
+	encoded, err := json.Marshal(resp)
+	if err != nil {
+		return "", err
+	}
+	var decoded struct {
+		Content models.ClaudeContent `json:"content"`
+	}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(core.JoinText(decoded.Content, "\n")), nil
+}
+
+// renderTranscript writes messages as plain text for the summarizer.
+func renderTranscript(messages []models.ClaudeMessage) string {
+	var transcript strings.Builder
+	for _, msg := range messages {
+		if msg.Role == core.ROLE_USER {
+			transcript.WriteString("User:\n")
+		} else {
+			transcript.WriteString("Assistant:\n")
+		}
+		for _, block := range msg.Content {
+			switch block := block.(type) {
+			case models.ClaudeContentBlockText:
+				transcript.WriteString(block.Text + "\n")
+			case models.ClaudeContentBlockImage:
+				transcript.WriteString("[image]\n")
+			case models.ClaudeContentBlockToolUse:
+				arguments, _ := json.Marshal(block.Input)
+				transcript.WriteString(fmt.Sprintf("[called tool %s with %s]\n", block.Name, arguments))
+			case models.ClaudeContentBlockToolResult:
+				output := []rune(core.JoinText(block.Content, "\n"))
+				if len(output) > OVERFLOW_TRUNCATE_KEEP_CHARS {
+					output = append(output[:OVERFLOW_TRUNCATE_KEEP_CHARS], []rune(" [...]")...)
+				}
+				transcript.WriteString(fmt.Sprintf("[tool result: %s]\n", string(output)))
+			}
+		}
+		transcript.WriteString("\n")
+	}
+	return transcript.String()
+}
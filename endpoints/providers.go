@@ -0,0 +1,127 @@
+package endpoints
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+	"github.com/sashabaranov/go-openai"
+)
+
+var providerBackends = map[string]backend{}
+
+// headerTransport adds the static headers configured for a provider to every upstream request.
+type headerTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	return t.base.RoundTrip(req)
+}
+
+type extraFieldsKey struct{}
+
+// withExtraFields stores request fields go-openai can't express, for extraFieldsTransport to add
+// to the upstream request body.
+func withExtraFields(ctx context.Context, fields map[string]any) context.Context {
+	if len(fields) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, extraFieldsKey{}, fields)
+}
+
+// extraFieldsTransport merges the extra fields of the request context into JSON request bodies.
+type extraFieldsTransport struct {
+	base http.RoundTripper
+}
+
+func (t *extraFieldsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fields, ok := req.Context().Value(extraFieldsKey{}).(map[string]any)
+	if !ok || req.Body == nil {
+		return t.base.RoundTrip(req)
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(body, &payload); err == nil {
+		for key, value := range fields {
+			payload[key] = value
+		}
+		if merged, err := json.Marshal(payload); err == nil {
+			body = merged
+		}
+	}
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	return t.base.RoundTrip(req)
+}
+
+func newProviderClient(provider *core.ProviderConfig) *openai.Client {
+	var openaiConfig openai.ClientConfig
+	if provider.Type == core.PROVIDER_AZURE {
+		// Azure routes by deployment: {base}/openai/deployments/{deployment}/chat/completions?api-version=...
+		// and authenticates with the api-key header, both handled by the Azure client config.
+		openaiConfig = openai.DefaultAzureConfig(provider.APIKey, provider.BaseURL)
+		openaiConfig.APIVersion = provider.APIVersion
+		if provider.Name == core.DEFAULT_PROVIDER {
+			openaiConfig.AzureModelMapperFunc = core.GetModelManager().MapOpenAIModelToAzureDeployment
+		} else {
+			// Routes of declared Azure providers name the deployment directly
+			openaiConfig.AzureModelMapperFunc = func(model string) string { return model }
+		}
+	} else {
+		openaiConfig = openai.DefaultConfig(provider.APIKey)
+		openaiConfig.BaseURL = provider.BaseURL
+	}
+
+	openaiConfig.HTTPClient = newProviderHTTPClient(provider)
+	return openai.NewClientWithConfig(openaiConfig)
+}
+
+// newProviderHTTPClient builds the HTTP client for a provider's upstream requests.
+func newProviderHTTPClient(provider *core.ProviderConfig) *http.Client {
+	httpClient := newRetryHTTPClient()
+	httpClient.Transport = &extraFieldsTransport{base: httpClient.Transport}
+	if len(provider.Headers) > 0 {
+		httpClient.Transport = &headerTransport{base: httpClient.Transport, headers: provider.Headers}
+	}
+	return httpClient
+}
+
+// newProviderBackend picks the backend speaking the API of a provider's type.
+func newProviderBackend(provider *core.ProviderConfig) backend {
+	switch provider.Type {
+	case core.PROVIDER_RESPONSES:
+		return &responsesBackend{client: newResponsesClient(provider)}
+	case core.PROVIDER_GEMINI:
+		return &geminiBackend{client: newGeminiClient(provider)}
+	case core.PROVIDER_OLLAMA:
+		return &ollamaBackend{client: newOllamaClient(provider)}
+	case core.PROVIDER_ANTHROPIC:
+		return &anthropicBackend{client: newAnthropicClient(provider)}
+	}
+	return &chatBackend{client: newProviderClient(provider)}
+}
+
+// backendForProvider returns the backend of a routed provider, falling back to the default provider.
+func backendForProvider(provider *core.ProviderConfig) backend {
+	if provider != nil {
+		if b, ok := providerBackends[provider.Name]; ok {
+			return b
+		}
+	}
+	return providerBackends[core.DEFAULT_PROVIDER]
+}
@@ -0,0 +1,118 @@
+package endpoints
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+	"github.com/jiaobendaye/go-claude-code-proxy/models"
+	"github.com/jiaobendaye/go-claude-code-proxy/streaming"
+	"github.com/sashabaranov/go-openai"
+)
+
+// responsesClient calls the OpenAI Responses API, which go-openai does not cover. Failures are
+// reported as go-openai errors so retries, fallbacks and error mapping treat both APIs alike.
+type responsesClient struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+func newResponsesClient(provider *core.ProviderConfig) *responsesClient {
+	return &responsesClient{
+		baseURL:    strings.TrimSuffix(provider.BaseURL, "/"),
+		apiKey:     provider.APIKey,
+		httpClient: newProviderHTTPClient(provider),
+	}
+}
+
+func (c *responsesClient) post(ctx context.Context, req *models.ResponsesRequest) (*http.Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/responses", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+	if req.Stream {
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		return nil, decodeUpstreamError(resp)
+	}
+	return resp, nil
+}
+
+func (c *responsesClient) create(ctx context.Context, req *models.ResponsesRequest) (models.ResponsesResponse, error) {
+	var response models.ResponsesResponse
+	resp, err := c.post(ctx, req)
+	if err != nil {
+		return response, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return response, err
+	}
+	if response.Error != nil {
+		return response, &openai.APIError{Code: response.Error.Code, Message: response.Error.Message, HTTPStatusCode: http.StatusInternalServerError}
+	}
+	return response, nil
+}
+
+func (c *responsesClient) createStream(ctx context.Context, req *models.ResponsesRequest) (*responsesEventStream, error) {
+	resp, err := c.post(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &responsesEventStream{newSSEStream[models.ResponsesStreamEvent](resp.Body)}, nil
+}
+
+// responsesEventStream turns error and response.failed events into go-openai errors with a
+// status, so a failure arriving as the first event can still be retried or fall back like an
+// error status. The response.created and response.in_progress events announcing every response
+// are skipped, they would otherwise be the first event.
+type responsesEventStream struct {
+	*sseStream[models.ResponsesStreamEvent]
+}
+
+func (s *responsesEventStream) Recv() (models.ResponsesStreamEvent, error) {
+	for {
+		event, err := s.sseStream.Recv()
+		if err != nil {
+			return event, err
+		}
+		switch event.Type {
+		case models.RESPONSES_EVENT_CREATED, models.RESPONSES_EVENT_IN_PROGRESS:
+			continue
+		}
+		if apiErr := streaming.ResponsesEventError(event); apiErr != nil {
+			apiErr.HTTPStatusCode = statusForResponsesErrorCode(apiErr.Code)
+			return event, apiErr
+		}
+		return event, nil
+	}
+}
+
+// statusForResponsesErrorCode returns the HTTP status matching the error code of a failed response.
+func statusForResponsesErrorCode(code any) int {
+	codeString, _ := code.(string)
+	switch {
+	case codeString == "rate_limit_exceeded":
+		return http.StatusTooManyRequests
+	case codeString == "context_length_exceeded", strings.HasPrefix(codeString, "invalid_"):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,291 @@
+package endpoints
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 8 * time.Second
+)
+
+// retryHint carries the Retry-After value of the last upstream response of an attempt.
+type retryHint struct {
+	mu    sync.Mutex
+	delay time.Duration
+}
+
+func (h *retryHint) set(delay time.Duration) {
+	h.mu.Lock()
+	h.delay = delay
+	h.mu.Unlock()
+}
+
+func (h *retryHint) get() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.delay
+}
+
+type retryHintKey struct{}
+
+// retryAfterTransport records Retry-After headers into the retryHint stored in the request context,
+// since go-openai does not expose response headers on errors.
+type retryAfterTransport struct {
+	base http.RoundTripper
+}
+
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if resp != nil {
+		if hint, ok := req.Context().Value(retryHintKey{}).(*retryHint); ok {
+			hint.set(parseRetryAfter(resp.Header))
+		}
+	}
+	return resp, err
+}
+
+func newRetryHTTPClient() *http.Client {
+	return &http.Client{Transport: &retryAfterTransport{base: http.DefaultTransport}}
+}
+
+// parseRetryAfter understands both the OpenAI specific retry-after-ms header and the standard
+// Retry-After header in its delay-seconds and HTTP-date forms.
+func parseRetryAfter(header http.Header) time.Duration {
+	if ms := header.Get("retry-after-ms"); ms != "" {
+		if val, err := strconv.ParseFloat(ms, 64); err == nil && val > 0 {
+			return time.Duration(val * float64(time.Millisecond))
+		}
+	}
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(at); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests,
+		http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout, 529:
+		return true
+	}
+	return false
+}
+
+// isRetryableError reports whether err is a transient upstream failure. Errors caused by the
+// caller's own context being done are never retried.
+func isRetryableError(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return isRetryableStatus(apiErr.HTTPStatusCode)
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return isRetryableStatus(reqErr.HTTPStatusCode)
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// retryPolicy drives the attempts of a single upstream call.
+type retryPolicy struct {
+	maxRetries      int
+	attemptTimeout  time.Duration
+	overallDeadline time.Time
+}
+
+func newRetryPolicy() *retryPolicy {
+	config := core.GetConfig()
+	return &retryPolicy{
+		maxRetries:      config.MaxRetries,
+		attemptTimeout:  time.Duration(config.RequestTimeout) * time.Second,
+		overallDeadline: time.Now().Add(time.Duration(config.RetryDeadline) * time.Second),
+	}
+}
+
+// attemptTimeoutLeft bounds the per-attempt timeout by what is left of the overall deadline.
+func (p *retryPolicy) attemptTimeoutLeft() time.Duration {
+	remaining := time.Until(p.overallDeadline)
+	if p.attemptTimeout > 0 && p.attemptTimeout < remaining {
+		return p.attemptTimeout
+	}
+	return remaining
+}
+
+// backoff returns how long to wait before the next attempt, or false if no attempt should follow.
+func (p *retryPolicy) backoff(ctx context.Context, attempt int, err error, hint time.Duration) (time.Duration, bool) {
+	if attempt >= p.maxRetries || !isRetryableError(ctx, err) {
+		return 0, false
+	}
+	delay := hint
+	if delay <= 0 {
+		delay = retryBaseDelay << attempt
+		if delay > retryMaxDelay {
+			delay = retryMaxDelay
+		}
+		// Equal jitter: half fixed, half random, to spread out concurrent retries.
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	}
+	if time.Now().Add(delay).After(p.overallDeadline) {
+		return 0, false
+	}
+	return delay, true
+}
+
+func (p *retryPolicy) wait(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// run calls attempt until it succeeds or fails with an error that is not worth retrying. Each
+// attempt gets a context carrying its retryHint, the attempt bounds its own duration.
+func (p *retryPolicy) run(ctx context.Context, model string, attempt func(attemptCtx context.Context) error) error {
+	for n := 0; ; n++ {
+		hint := &retryHint{}
+		err := attempt(context.WithValue(ctx, retryHintKey{}, hint))
+		if err == nil {
+			return nil
+		}
+		delay, ok := p.backoff(ctx, n, err, hint.get())
+		if !ok {
+			return withRetryAfter(err, hint.get())
+		}
+		log.Printf("Upstream attempt %d/%d for model %s failed: %v; retrying in %s", n+1, p.maxRetries+1, model, err, delay)
+		if err := p.wait(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// streamAttempt is the context of one attempt to open a stream. Its timeout only covers the
+// time to first event: once that arrived, the stream keeps the context until it is closed.
+type streamAttempt struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	timer  *time.Timer
+}
+
+func (p *retryPolicy) startStreamAttempt(ctx context.Context) *streamAttempt {
+	attemptCtx, cancel := context.WithCancel(ctx)
+	return &streamAttempt{ctx: attemptCtx, cancel: cancel, timer: time.AfterFunc(p.attemptTimeoutLeft(), cancel)}
+}
+
+// established stops the timeout once the first event arrived.
+func (a *streamAttempt) established() {
+	a.timer.Stop()
+}
+
+// failed releases the attempt and reports a cancellation by the attempt timer as a timeout.
+func (a *streamAttempt) failed(parent context.Context, err error) error {
+	a.timer.Stop()
+	a.cancel()
+	if errors.Is(err, context.Canceled) && parent.Err() == nil {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// callWithRetry performs a non streaming upstream call, retrying transient failures.
+func callWithRetry[T any](ctx context.Context, model string, call func(attemptCtx context.Context) (T, error)) (T, error) {
+	policy := newRetryPolicy()
+	var result T
+	err := policy.run(ctx, model, func(attemptCtx context.Context) error {
+		attemptCtx, cancel := context.WithTimeout(attemptCtx, policy.attemptTimeoutLeft())
+		defer cancel()
+		var err error
+		result, err = call(attemptCtx)
+		return err
+	})
+	return result, err
+}
+
+// eventStream is an upstream stream of events, like go-openai chat completion streams.
+type eventStream[T any] interface {
+	Recv() (T, error)
+	Close() error
+}
+
+// retryableStream is an upstream stream whose first event has already been received.
+// Nothing has been forwarded to the client before that point, so the whole stream can be
+// re-established safely until the first event arrives.
+type retryableStream[T any] struct {
+	stream     eventStream[T]
+	cancel     context.CancelFunc
+	first      T
+	firstErr   error
+	firstTaken bool
+}
+
+func (s *retryableStream[T]) Recv() (T, error) {
+	if !s.firstTaken {
+		s.firstTaken = true
+		if s.firstErr != nil {
+			var zero T
+			return zero, s.firstErr
+		}
+		return s.first, nil
+	}
+	return s.stream.Recv()
+}
+
+func (s *retryableStream[T]) Close() error {
+	defer s.cancel()
+	return s.stream.Close()
+}
+
+// openStreamWithRetry opens an upstream stream and waits for its first event, retrying transient
+// failures. The per-attempt timeout only covers the time to first event.
+func openStreamWithRetry[T any](ctx context.Context, model string, open func(attemptCtx context.Context) (eventStream[T], error)) (*retryableStream[T], error) {
+	policy := newRetryPolicy()
+	var result *retryableStream[T]
+	err := policy.run(ctx, model, func(attemptCtx context.Context) error {
+		attempt := policy.startStreamAttempt(attemptCtx)
+		stream, err := open(attempt.ctx)
+		if err != nil {
+			return attempt.failed(ctx, err)
+		}
+		first, err := stream.Recv()
+		if err != nil && err != io.EOF {
+			stream.Close()
+			return attempt.failed(ctx, err)
+		}
+		attempt.established()
+		result = &retryableStream[T]{stream: stream, cancel: attempt.cancel, first: first, firstErr: err}
+		return nil
+	})
+	return result, err
+}
@@ -0,0 +1,246 @@
+package endpoints
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jiaobendaye/go-claude-code-proxy/conversion"
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+	"github.com/jiaobendaye/go-claude-code-proxy/models"
+)
+
+// SOURCE_FETCH_MAX_BYTES bounds the images and documents downloaded for upstreams that only take
+// their data.
+const SOURCE_FETCH_MAX_BYTES = 20 << 20
+
+// SOURCE_FETCH_MAX_REDIRECTS bounds the redirects followed when downloading a URL.
+const SOURCE_FETCH_MAX_REDIRECTS = 5
+
+// sourceHTTPClient downloads the URLs sent by clients. Every connection, redirects included, is
+// checked by checkSourceAddress once the host is resolved; no HTTP proxy is used, so the address
+// checked is the one connected to.
+var sourceHTTPClient = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 10 * time.Second, Control: checkSourceAddress}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= SOURCE_FETCH_MAX_REDIRECTS {
+			return fmt.Errorf("stopped after %d redirects", SOURCE_FETCH_MAX_REDIRECTS)
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return fmt.Errorf("redirected to a %s URL", req.URL.Scheme)
+		}
+		return nil
+	},
+}
+
+// nonPublicNetworks are the ranges refused on top of those the net.IP methods tell: "this
+// network", which reaches the host itself, shared address space, used by some cloud metadata
+// services, and the NAT64 prefix for local use, which may translate to any IPv4 network.
+var nonPublicNetworks = parseNetworks("0.0.0.0/8", "100.64.0.0/10", "64:ff9b:1::/48")
+
+// nat64Network is the well-known NAT64 prefix, whose addresses end with the IPv4 address they
+// reach.
+var nat64Network = parseNetworks("64:ff9b::/96")[0]
+
+// sixToFourNetwork is the 6to4 prefix, whose addresses carry an IPv4 address after it.
+var sixToFourNetwork = parseNetworks("2002::/16")[0]
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := []*net.IPNet{}
+	for _, cidr := range cidrs {
+		_, network, _ := net.ParseCIDR(cidr)
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// checkSourceAddress refuses connections to loopback, private, link-local and other non public
+// addresses unless FETCH_PRIVATE_URLS is set, so that clients can't make the proxy reach its own
+// network or the metadata service of its host.
+func checkSourceAddress(network, address string, _ syscall.RawConn) error {
+	if core.GetConfig().FetchPrivateURLs {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("the address %s is not public", host)
+	}
+	return nil
+}
+
+// isPublicIP reports whether an address is public. IPv6 addresses embedding an IPv4 address,
+// through NAT64 or 6to4, are judged by the IPv4 address they reach.
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	if ip.To4() == nil {
+		if nat64Network.Contains(ip) {
+			return isPublicIP(ip[12:16])
+		}
+		if sixToFourNetwork.Contains(ip) {
+			return isPublicIP(ip[2:6])
+		}
+	}
+	return true
+}
+
+// fetchesImageURLs reports whether the upstream API of a provider takes image URLs.
+func fetchesImageURLs(provider *core.ProviderConfig) bool {
+	if provider == nil {
+		return true
+	}
+	switch provider.Type {
+	case core.PROVIDER_GEMINI, core.PROVIDER_OLLAMA:
+		return false
+	}
+	return true
+}
+
+// inlineURLs downloads the URL documents of the messages, including those returned by tools, and
+// their URL images when images is set. The messages themselves are returned when nothing was
+// downloaded.
+func inlineURLs(ctx context.Context, messages []models.ClaudeMessage, images bool) ([]models.ClaudeMessage, error) {
+	var inlined []models.ClaudeMessage
+	for i, msg := range messages {
+		content, changed, err := inlineContent(ctx, msg.Content, images)
+		if err != nil {
+			return nil, err
+		}
+		if !changed {
+			continue
+		}
+		if inlined == nil {
+			inlined = append([]models.ClaudeMessage(nil), messages...)
+		}
+		inlined[i] = models.ClaudeMessage{Role: msg.Role, Content: content}
+	}
+	if inlined == nil {
+		return messages, nil
+	}
+	return inlined, nil
+}
+
+func inlineContent(ctx context.Context, content models.ClaudeContent, images bool) (models.ClaudeContent, bool, error) {
+	inlined := append(models.ClaudeContent(nil), content...)
+	changed := false
+	for i, block := range inlined {
+		switch block := block.(type) {
+		case models.ClaudeContentBlockImage:
+			if !images || block.Source.Type != core.SOURCE_URL {
+				continue
+			}
+			source, err := fetchImage(ctx, block.Source.URL)
+			if err != nil {
+				return nil, false, err
+			}
+			block.Source = source
+			inlined[i] = block
+			changed = true
+		case models.ClaudeContentBlockDocument:
+			if block.Source.Type != core.SOURCE_URL {
+				continue
+			}
+			source, err := fetchDocument(ctx, block.Source.URL)
+			if err != nil {
+				return nil, false, err
+			}
+			block.Source = source
+			inlined[i] = block
+			changed = true
+		case models.ClaudeContentBlockToolResult:
+			items, itemsChanged, err := inlineContent(ctx, block.Content, images)
+			if err != nil {
+				return nil, false, err
+			}
+			if itemsChanged {
+				block.Content = items
+				inlined[i] = block
+				changed = true
+			}
+		}
+	}
+	return inlined, changed, nil
+}
+
+// fetchImage downloads an image URL into a base64 image source.
+func fetchImage(ctx context.Context, imageURL string) (models.ClaudeImageSource, error) {
+	data, mediaType, err := fetchSource(ctx, "image", imageURL)
+	if err != nil {
+		return models.ClaudeImageSource{}, err
+	}
+	if !conversion.IsImageMediaType(mediaType) {
+		return models.ClaudeImageSource{}, fetchError("image", imageURL, fmt.Sprintf("%s is not a supported image type", mediaType))
+	}
+	return models.ClaudeImageSource{Type: core.SOURCE_BASE64, MediaType: mediaType, Data: base64.StdEncoding.EncodeToString(data)}, nil
+}
+
+// fetchDocument downloads a document URL into a base64 PDF or a text document source.
+func fetchDocument(ctx context.Context, documentURL string) (models.ClaudeDocumentSource, error) {
+	data, mediaType, err := fetchSource(ctx, "document", documentURL)
+	if err != nil {
+		return models.ClaudeDocumentSource{}, err
+	}
+	switch {
+	case mediaType == conversion.MEDIA_TYPE_PDF:
+		return models.ClaudeDocumentSource{ClaudeImageSource: models.ClaudeImageSource{
+			Type: core.SOURCE_BASE64, MediaType: mediaType, Data: base64.StdEncoding.EncodeToString(data),
+		}}, nil
+	case strings.HasPrefix(mediaType, conversion.MEDIA_TYPE_TEXT):
+		return models.ClaudeDocumentSource{ClaudeImageSource: models.ClaudeImageSource{
+			Type: core.SOURCE_TEXT, MediaType: conversion.MEDIA_TYPE_TEXT, Data: string(data),
+		}}, nil
+	}
+	return models.ClaudeDocumentSource{}, fetchError("document", documentURL, fmt.Sprintf("%s is not a PDF or plain text", mediaType))
+}
+
+// fetchSource downloads the data of an image or document URL, with its sniffed media type.
+func fetchSource(ctx context.Context, kind, sourceURL string) ([]byte, string, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceURL, nil)
+	if err != nil {
+		return nil, "", fetchError(kind, sourceURL, err.Error())
+	}
+	resp, err := sourceHTTPClient.Do(httpReq)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, "", ctx.Err()
+		}
+		return nil, "", fetchError(kind, sourceURL, err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fetchError(kind, sourceURL, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, SOURCE_FETCH_MAX_BYTES+1))
+	if err != nil {
+		return nil, "", fetchError(kind, sourceURL, err.Error())
+	}
+	if len(data) > SOURCE_FETCH_MAX_BYTES {
+		return nil, "", fetchError(kind, sourceURL, fmt.Sprintf("the %s is larger than %d bytes", kind, SOURCE_FETCH_MAX_BYTES))
+	}
+	return data, http.DetectContentType(data), nil
+}
+
+func fetchError(kind, sourceURL, reason string) error {
+	message := fmt.Sprintf("Unable to download the %s from %s: %s", kind, sourceURL, reason)
+	return newAnthropicError(http.StatusBadRequest, ERROR_INVALID_REQUEST, message)
+}
@@ -0,0 +1,36 @@
+package endpoints
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		address string
+		public  bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"169.254.169.254", false},
+		{"100.100.100.200", false},
+		{"0.0.0.0", false},
+		{"::1", false},
+		{"fd00::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"64:ff9b::a9fe:a9fe", false},
+		{"64:ff9b::7f00:1", false},
+		{"64:ff9b:1::a00:1", false},
+		{"64:ff9b::5db8:d822", true},
+		{"2002:a9fe:a9fe::1", false},
+		{"2002:5db8:d822::1", true},
+	}
+	for _, tt := range tests {
+		if got := isPublicIP(net.ParseIP(tt.address)); got != tt.public {
+			t.Errorf("isPublicIP(%s) = %t, want %t", tt.address, got, tt.public)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package endpoints
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// decodeUpstreamError turns an error response of a plain HTTP upstream into an openai.APIError,
+// or an openai.RequestError when the body is not an error object. OpenAI errors carry a type,
+// Google errors a status, both end up in Type. Ollama errors are a bare message.
+func decodeUpstreamError(resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+	var message struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &message); err == nil && message.Error != "" {
+		return &openai.APIError{Message: message.Error, HTTPStatus: resp.Status, HTTPStatusCode: resp.StatusCode}
+	}
+	var envelope struct {
+		Error *openai.APIError `json:"error"`
+	}
+	if err := json.Unmarshal(body, &envelope); err == nil && envelope.Error != nil && envelope.Error.Message != "" {
+		if envelope.Error.Type == "" {
+			var status struct {
+				Error struct {
+					Status string `json:"status"`
+				} `json:"error"`
+			}
+			json.Unmarshal(body, &status)
+			envelope.Error.Type = status.Error.Status
+		}
+		envelope.Error.HTTPStatus = resp.Status
+		envelope.Error.HTTPStatusCode = resp.StatusCode
+		return envelope.Error
+	}
+	return &openai.RequestError{
+		HTTPStatus:     resp.Status,
+		HTTPStatusCode: resp.StatusCode,
+		Err:            fmt.Errorf("error, status code: %d", resp.StatusCode),
+		Body:           body,
+	}
+}
+
+// sseStream reads server-sent events whose data are JSON objects of type T.
+type sseStream[T any] struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+}
+
+func newSSEStream[T any](body io.ReadCloser) *sseStream[T] {
+	return &sseStream[T]{body: body, reader: bufio.NewReader(body)}
+}
+
+func (s *sseStream[T]) Recv() (T, error) {
+	var event T
+	var data strings.Builder
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF && data.Len() > 0 {
+				break
+			}
+			return event, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if data.Len() > 0 {
+				break
+			}
+			continue
+		}
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(value, " "))
+		}
+	}
+	if data.String() == "[DONE]" {
+		return event, io.EOF
+	}
+	err := json.Unmarshal([]byte(data.String()), &event)
+	return event, err
+}
+
+func (s *sseStream[T]) Close() error {
+	return s.body.Close()
+}
+
+// ndjsonStream reads newline delimited JSON objects of type T.
+type ndjsonStream[T any] struct {
+	body    io.ReadCloser
+	decoder *json.Decoder
+}
+
+func newNDJSONStream[T any](body io.ReadCloser) *ndjsonStream[T] {
+	return &ndjsonStream[T]{body: body, decoder: json.NewDecoder(body)}
+}
+
+func (s *ndjsonStream[T]) Recv() (T, error) {
+	var event T
+	err := s.decoder.Decode(&event)
+	return event, err
+}
+
+func (s *ndjsonStream[T]) Close() error {
+	return s.body.Close()
+}
@@ -1,69 +1,155 @@
 package models
 
+import "encoding/json"
+
 type ClaudeContentBlockText struct {
-    Type string `json:"type"`
-    Text string `json:"text"`
+	Type      string           `json:"type"`
+	Text      string           `json:"text"`
+	Citations []map[string]any `json:"citations,omitempty"`
+}
+
+// ClaudeImageSource is the source of an image or document block: base64 data, a URL or a file id.
+type ClaudeImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+	FileID    string `json:"file_id,omitempty"`
 }
 
 type ClaudeContentBlockImage struct {
-    Type   string         `json:"type"`
-    Source map[string]any `json:"source"`
+	Type   string            `json:"type"`
+	Source ClaudeImageSource `json:"source"`
+}
+
+// ClaudeDocumentSource extends the image sources with inline text and content-block documents.
+type ClaudeDocumentSource struct {
+	ClaudeImageSource
+	Content ClaudeContent `json:"content,omitempty"`
+}
+
+type ClaudeContentBlockDocument struct {
+	Type      string               `json:"type"`
+	Source    ClaudeDocumentSource `json:"source"`
+	Title     string               `json:"title,omitempty"`
+	Context   string               `json:"context,omitempty"`
+	Citations map[string]any       `json:"citations,omitempty"`
 }
 
 type ClaudeContentBlockToolUse struct {
-    Type  string         `json:"type"`
-    ID    string         `json:"id"`
-    Name  string         `json:"name"`
-    Input map[string]any `json:"input"`
+	Type  string         `json:"type"`
+	ID    string         `json:"id"`
+	Name  string         `json:"name"`
+	Input map[string]any `json:"input"`
 }
 
 type ClaudeContentBlockToolResult struct {
-    Type       string         `json:"type"`
-    ToolUseID  string         `json:"tool_use_id"`
-    Content    any            `json:"content"`
+	Type      string        `json:"type"`
+	ToolUseID string        `json:"tool_use_id"`
+	Content   ClaudeContent `json:"content,omitempty"`
+	IsError   bool          `json:"is_error,omitempty"`
+}
+
+type ClaudeContentBlockThinking struct {
+	Type      string `json:"type"`
+	Thinking  string `json:"thinking"`
+	Signature string `json:"signature,omitempty"`
 }
 
-type ClaudeSystemContent struct {
-    Type string `json:"type"`
-    Text string `json:"text"`
+type ClaudeContentBlockRedactedThinking struct {
+	Type string `json:"type"`
+	Data string `json:"data"`
 }
 
 type ClaudeMessage struct {
-    Role    string       `json:"role"`
-    Content any          `json:"content"`
+	Role    string        `json:"role"`
+	Content ClaudeContent `json:"content"`
 }
 
 type ClaudeTool struct {
-    Name        string         `json:"name"`
-    Description string         `json:"description,omitempty"`
-    InputSchema map[string]any `json:"input_schema"`
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"input_schema"`
 }
 
+// ClaudeThinkingConfig is the extended thinking setting, {"type":"enabled","budget_tokens":N}
+// or {"type":"disabled"}.
 type ClaudeThinkingConfig struct {
-    Enabled bool `json:"enabled"`
+	Type         string `json:"type,omitempty"`
+	BudgetTokens int    `json:"budget_tokens,omitempty"`
+}
+
+func (c ClaudeThinkingConfig) IsEnabled() bool {
+	return c.Type == "enabled"
 }
 
 type ClaudeMessagesRequest struct {
-    Model         string               `json:"model"`
-    MaxTokens     int                  `json:"max_tokens"`
-    Messages      []ClaudeMessage      `json:"messages"`
-    System        any                  `json:"system,omitempty"`
-    StopSequences []string             `json:"stop_sequences,omitempty"`
-    Stream        bool                 `json:"stream,omitempty"`
-    Temperature   float32              `json:"temperature,omitempty"`
-    TopP          float32              `json:"top_p,omitempty"`
-    TopK          int                  `json:"top_k,omitempty"`
-    Metadata      map[string]any       `json:"metadata,omitempty"`
-    Tools         []ClaudeTool         `json:"tools,omitempty"`
-    ToolChoice    map[string]any       `json:"tool_choice,omitempty"`
-    Thinking      ClaudeThinkingConfig `json:"thinking,omitempty"`
+	Model         string               `json:"model"`
+	MaxTokens     int                  `json:"max_tokens"`
+	Messages      []ClaudeMessage      `json:"messages"`
+	System        ClaudeContent        `json:"system,omitempty"`
+	StopSequences []string             `json:"stop_sequences,omitempty"`
+	Stream        bool                 `json:"stream,omitempty"`
+	Temperature   float32              `json:"temperature,omitempty"`
+	TopP          float32              `json:"top_p,omitempty"`
+	TopK          int                  `json:"top_k,omitempty"`
+	Metadata      map[string]any       `json:"metadata,omitempty"`
+	Tools         []ClaudeTool         `json:"tools,omitempty"`
+	ToolChoice    map[string]any       `json:"tool_choice,omitempty"`
+	Thinking      ClaudeThinkingConfig `json:"thinking,omitempty"`
 }
 
 type ClaudeTokenCountRequest struct {
-    Model      string               `json:"model"`
-    Messages   []ClaudeMessage      `json:"messages"`
-    System     any                  `json:"system,omitempty"`
-    Tools      []ClaudeTool         `json:"tools,omitempty"`
-    Thinking   ClaudeThinkingConfig `json:"thinking,omitempty"`
-    ToolChoice map[string]any       `json:"tool_choice,omitempty"`
-}
\ No newline at end of file
+	Model      string               `json:"model"`
+	Messages   []ClaudeMessage      `json:"messages"`
+	System     ClaudeContent        `json:"system,omitempty"`
+	Tools      []ClaudeTool         `json:"tools,omitempty"`
+	Thinking   ClaudeThinkingConfig `json:"thinking,omitempty"`
+	ToolChoice map[string]any       `json:"tool_choice,omitempty"`
+}
+
+// ClaudeModelInfo is an entry of the /v1/models list. Upstream and Capabilities are additions of
+// the proxy, describing where the model is routed and what it can do.
+type ClaudeModelInfo struct {
+	Type         string                   `json:"type"`
+	ID           string                   `json:"id"`
+	DisplayName  string                   `json:"display_name"`
+	CreatedAt    string                   `json:"created_at"`
+	Upstream     *ClaudeModelUpstream     `json:"upstream,omitempty"`
+	Capabilities *ClaudeModelCapabilities `json:"capabilities,omitempty"`
+}
+
+// ClaudeModelUpstream is the provider and upstream model a listed model is routed to.
+type ClaudeModelUpstream struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+}
+
+// ClaudeModelCapabilities describes what the upstream model of a listed model supports. A zero
+// ContextWindow means it is unknown.
+type ClaudeModelCapabilities struct {
+	Vision        bool `json:"vision"`
+	Tools         bool `json:"tools"`
+	Thinking      bool `json:"thinking"`
+	Documents     bool `json:"documents"`
+	ContextWindow int  `json:"context_window,omitempty"`
+}
+
+// ClaudeStreamEvent is an event of a Claude stream received from an Anthropic upstream. Raw keeps
+// the event data exactly as sent, so the event can be relayed unchanged.
+type ClaudeStreamEvent struct {
+	Type string
+	Raw  json.RawMessage
+}
+
+func (e *ClaudeStreamEvent) UnmarshalJSON(data []byte) error {
+	var event struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return err
+	}
+	e.Type = event.Type
+	e.Raw = append(json.RawMessage(nil), data...)
+	return nil
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ClaudeContentBlock is one element of a Claude content array. Decoding produces one of the
+// ClaudeContentBlock* struct values below, chosen by the block's "type" field.
+type ClaudeContentBlock interface {
+	BlockType() string
+}
+
+func (b ClaudeContentBlockText) BlockType() string             { return b.Type }
+func (b ClaudeContentBlockImage) BlockType() string            { return b.Type }
+func (b ClaudeContentBlockDocument) BlockType() string         { return b.Type }
+func (b ClaudeContentBlockToolUse) BlockType() string          { return b.Type }
+func (b ClaudeContentBlockToolResult) BlockType() string       { return b.Type }
+func (b ClaudeContentBlockThinking) BlockType() string         { return b.Type }
+func (b ClaudeContentBlockRedactedThinking) BlockType() string { return b.Type }
+func (b ClaudeContentBlockUnknown) BlockType() string          { return b.Type }
+
+// ClaudeContent is a list of content blocks. Claude accepts a plain string wherever content
+// is expected, which decodes to a single text block.
+type ClaudeContent []ClaudeContentBlock
+
+func (c *ClaudeContent) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*c = nil
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*c = ClaudeContent{ClaudeContentBlockText{Type: "text", Text: text}}
+		return nil
+	}
+
+	var rawBlocks []json.RawMessage
+	if err := json.Unmarshal(data, &rawBlocks); err != nil {
+		return fmt.Errorf("content must be a string or an array of content blocks")
+	}
+	blocks := make(ClaudeContent, 0, len(rawBlocks))
+	for i, raw := range rawBlocks {
+		block, err := UnmarshalContentBlock(raw)
+		if err != nil {
+			return fmt.Errorf("content block %d: %w", i, err)
+		}
+		blocks = append(blocks, block)
+	}
+	*c = blocks
+	return nil
+}
+
+// UnmarshalContentBlock decodes a single content block into its concrete type.
+func UnmarshalContentBlock(data []byte) (ClaudeContentBlock, error) {
+	var header struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+
+	switch header.Type {
+	case "text":
+		return decodeBlock[ClaudeContentBlockText](data)
+	case "image":
+		return decodeBlock[ClaudeContentBlockImage](data)
+	case "document":
+		return decodeBlock[ClaudeContentBlockDocument](data)
+	case "tool_use":
+		return decodeBlock[ClaudeContentBlockToolUse](data)
+	case "tool_result":
+		return decodeBlock[ClaudeContentBlockToolResult](data)
+	case "thinking":
+		return decodeBlock[ClaudeContentBlockThinking](data)
+	case "redacted_thinking":
+		return decodeBlock[ClaudeContentBlockRedactedThinking](data)
+	case "":
+		return nil, fmt.Errorf("missing block type")
+	}
+	return ClaudeContentBlockUnknown{Type: header.Type, Raw: append(json.RawMessage(nil), data...)}, nil
+}
+
+func decodeBlock[T ClaudeContentBlock](data []byte) (ClaudeContentBlock, error) {
+	var block T
+	if err := json.Unmarshal(data, &block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// ClaudeContentBlockUnknown keeps blocks of types the proxy does not know about, verbatim.
+type ClaudeContentBlockUnknown struct {
+	Type string
+	Raw  json.RawMessage
+}
+
+func (b ClaudeContentBlockUnknown) MarshalJSON() ([]byte, error) {
+	return b.Raw, nil
+}
@@ -0,0 +1,78 @@
+package models
+
+// Types of the Ollama /api/chat and /api/tags APIs, see https://github.com/ollama/ollama/blob/main/docs/api.md
+
+const (
+	OLLAMA_DONE_STOP   = "stop"
+	OLLAMA_DONE_LENGTH = "length"
+)
+
+type OllamaChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []OllamaMessage `json:"messages"`
+	Tools    []OllamaTool    `json:"tools,omitempty"`
+	Stream   bool            `json:"stream"`
+	// Think is a bool, or "low", "medium", "high" for models taking a reasoning effort
+	Think     any            `json:"think,omitempty"`
+	Options   map[string]any `json:"options,omitempty"`
+	KeepAlive string         `json:"keep_alive,omitempty"`
+}
+
+// OllamaMessage is a chat message. Images are base64 encoded without data URL prefix, ToolName
+// names the tool a tool message answers.
+type OllamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Thinking  string           `json:"thinking,omitempty"`
+	Images    []string         `json:"images,omitempty"`
+	ToolCalls []OllamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+type OllamaToolCall struct {
+	ID       string `json:"id,omitempty"`
+	Function struct {
+		Index     int            `json:"index,omitempty"`
+		Name      string         `json:"name"`
+		Arguments map[string]any `json:"arguments"`
+	} `json:"function"`
+}
+
+type OllamaTool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string         `json:"name"`
+		Description string         `json:"description,omitempty"`
+		Parameters  map[string]any `json:"parameters,omitempty"`
+	} `json:"function"`
+}
+
+// OllamaChatResponse is a non streaming response, or one line of a streamed NDJSON response.
+// Counts and DoneReason are only set once Done.
+type OllamaChatResponse struct {
+	Model           string        `json:"model"`
+	CreatedAt       string        `json:"created_at"`
+	Message         OllamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason,omitempty"`
+	PromptEvalCount int           `json:"prompt_eval_count,omitempty"`
+	EvalCount       int           `json:"eval_count,omitempty"`
+	// Error is set on error lines of a stream
+	Error string `json:"error,omitempty"`
+}
+
+type OllamaModel struct {
+	Name       string `json:"name"`
+	Model      string `json:"model"`
+	ModifiedAt string `json:"modified_at"`
+	Size       int64  `json:"size"`
+	Details    struct {
+		Family            string `json:"family"`
+		ParameterSize     string `json:"parameter_size"`
+		QuantizationLevel string `json:"quantization_level"`
+	} `json:"details"`
+}
+
+type OllamaTagsResponse struct {
+	Models []OllamaModel `json:"models"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"encoding/json"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// OpenAIChatRequest is a chat completion request as OpenAI clients send it to the proxy. It only
+// differs from the go-openai request in accepting stop as a single string.
+type OpenAIChatRequest struct {
+	openai.ChatCompletionRequest
+	Stop StringList `json:"stop,omitempty"`
+}
+
+// StringList is a list of strings that also decodes from a single string.
+type StringList []string
+
+func (l *StringList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*l = StringList{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
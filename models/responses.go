@@ -0,0 +1,133 @@
+package models
+
+// Types of the OpenAI Responses API, see https://platform.openai.com/docs/api-reference/responses
+
+const (
+	RESPONSES_ITEM_MESSAGE              = "message"
+	RESPONSES_ITEM_FUNCTION_CALL        = "function_call"
+	RESPONSES_ITEM_FUNCTION_CALL_OUTPUT = "function_call_output"
+	RESPONSES_ITEM_REASONING            = "reasoning"
+
+	RESPONSES_CONTENT_INPUT_TEXT   = "input_text"
+	RESPONSES_CONTENT_INPUT_IMAGE  = "input_image"
+	RESPONSES_CONTENT_INPUT_FILE   = "input_file"
+	RESPONSES_CONTENT_OUTPUT_TEXT  = "output_text"
+	RESPONSES_CONTENT_REFUSAL      = "refusal"
+	RESPONSES_CONTENT_SUMMARY_TEXT = "summary_text"
+
+	RESPONSES_STATUS_INCOMPLETE = "incomplete"
+
+	RESPONSES_EVENT_CREATED                  = "response.created"
+	RESPONSES_EVENT_IN_PROGRESS              = "response.in_progress"
+	RESPONSES_EVENT_OUTPUT_ITEM_ADDED        = "response.output_item.added"
+	RESPONSES_EVENT_OUTPUT_ITEM_DONE         = "response.output_item.done"
+	RESPONSES_EVENT_OUTPUT_TEXT_DELTA        = "response.output_text.delta"
+	RESPONSES_EVENT_REFUSAL_DELTA            = "response.refusal.delta"
+	RESPONSES_EVENT_FUNCTION_ARGUMENTS_DELTA = "response.function_call_arguments.delta"
+	RESPONSES_EVENT_REASONING_SUMMARY_DELTA  = "response.reasoning_summary_text.delta"
+	RESPONSES_EVENT_REASONING_SUMMARY_PART   = "response.reasoning_summary_part.added"
+	RESPONSES_EVENT_COMPLETED                = "response.completed"
+	RESPONSES_EVENT_INCOMPLETE               = "response.incomplete"
+	RESPONSES_EVENT_FAILED                   = "response.failed"
+	RESPONSES_EVENT_ERROR                    = "error"
+
+	RESPONSES_INCLUDE_ENCRYPTED_REASONING = "reasoning.encrypted_content"
+)
+
+type ResponsesRequest struct {
+	Model           string              `json:"model"`
+	Instructions    string              `json:"instructions,omitempty"`
+	Input           []ResponsesItem     `json:"input"`
+	MaxOutputTokens int                 `json:"max_output_tokens,omitempty"`
+	Temperature     *float32            `json:"temperature,omitempty"`
+	TopP            *float32            `json:"top_p,omitempty"`
+	Tools           []ResponsesTool     `json:"tools,omitempty"`
+	ToolChoice      any                 `json:"tool_choice,omitempty"`
+	Reasoning       *ResponsesReasoning `json:"reasoning,omitempty"`
+	Include         []string            `json:"include,omitempty"`
+	Store           bool                `json:"store"`
+	Stream          bool                `json:"stream,omitempty"`
+}
+
+type ResponsesReasoning struct {
+	Effort  string `json:"effort,omitempty"`
+	Summary string `json:"summary,omitempty"`
+}
+
+type ResponsesTool struct {
+	Type        string         `json:"type"`
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters,omitempty"`
+}
+
+// ResponsesItem is an input or output item. Which fields are set depends on Type:
+// message, function_call, function_call_output or reasoning.
+type ResponsesItem struct {
+	Type   string `json:"type"`
+	ID     string `json:"id,omitempty"`
+	Status string `json:"status,omitempty"`
+
+	// message
+	Role    string             `json:"role,omitempty"`
+	Content []ResponsesContent `json:"content,omitempty"`
+
+	// function_call and function_call_output
+	CallID    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+	Output    string `json:"output,omitempty"`
+
+	// reasoning, summary must be present even when empty
+	Summary          *[]ResponsesContent `json:"summary,omitempty"`
+	EncryptedContent string              `json:"encrypted_content,omitempty"`
+}
+
+// ResponsesContent is a content part: input_text, input_image, output_text, refusal or summary_text.
+type ResponsesContent struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+	FileData string `json:"file_data,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	Refusal  string `json:"refusal,omitempty"`
+}
+
+type ResponsesUsage struct {
+	InputTokens        int `json:"input_tokens"`
+	OutputTokens       int `json:"output_tokens"`
+	InputTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"input_tokens_details"`
+}
+
+type ResponsesError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type ResponsesResponse struct {
+	ID                string          `json:"id"`
+	Status            string          `json:"status"`
+	Output            []ResponsesItem `json:"output"`
+	Usage             *ResponsesUsage `json:"usage,omitempty"`
+	Error             *ResponsesError `json:"error,omitempty"`
+	IncompleteDetails *struct {
+		Reason string `json:"reason"`
+	} `json:"incomplete_details,omitempty"`
+}
+
+// ResponsesStreamEvent is one server-sent event of a streamed response. Fields not used by
+// an event type are left empty.
+type ResponsesStreamEvent struct {
+	Type         string             `json:"type"`
+	OutputIndex  int                `json:"output_index"`
+	SummaryIndex int                `json:"summary_index"`
+	ItemID       string             `json:"item_id,omitempty"`
+	Delta        string             `json:"delta,omitempty"`
+	Item         *ResponsesItem     `json:"item,omitempty"`
+	Response     *ResponsesResponse `json:"response,omitempty"`
+	// error events
+	Code    any    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
@@ -0,0 +1,141 @@
+package streaming
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+	"github.com/jiaobendaye/go-claude-code-proxy/models"
+)
+
+// ClaudeEventReceiver is implemented by streams of an Anthropic upstream.
+type ClaudeEventReceiver interface {
+	Recv() (models.ClaudeStreamEvent, error)
+}
+
+// errIncompleteStream reports an upstream Claude stream ending before message_stop.
+var errIncompleteStream = errors.New("upstream stream ended before message_stop")
+
+// RelayClaudeStream writes the events of an Anthropic upstream to the client unchanged. It
+// returns nil once message_stop went out, any other end of the stream is an error.
+func RelayClaudeStream(ctx context.Context, stream ClaudeEventReceiver, w *SSEWriter) error {
+	for {
+		event, err := stream.Recv()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == io.EOF {
+			return errIncompleteStream
+		}
+		if err != nil {
+			return err
+		}
+		if err := w.SendRaw(event.Type, event.Raw); err != nil {
+			return err
+		}
+		if event.Type == core.EVENT_MESSAGE_STOP {
+			return nil
+		}
+	}
+}
+
+// claudeEventData holds the fields of Claude stream events the feeder needs.
+type claudeEventData struct {
+	Index   int `json:"index"`
+	Message struct {
+		Usage map[string]any `json:"usage"`
+	} `json:"message"`
+	ContentBlock struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+		Name string `json:"name"`
+		Data string `json:"data"`
+		Text string `json:"text"`
+	} `json:"content_block"`
+	Delta struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		Thinking    string `json:"thinking"`
+		Signature   string `json:"signature"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage map[string]any `json:"usage"`
+}
+
+// AnthropicFeeder applies the events of an Anthropic upstream to a translator, for clients that
+// don't take the upstream stream as is. Block indexes stand in for tool call indexes, blocks
+// other than text, thinking and tool_use are dropped.
+type AnthropicFeeder struct {
+	t *Translator
+}
+
+func NewAnthropicFeeder(t *Translator) *AnthropicFeeder {
+	return &AnthropicFeeder{t: t}
+}
+
+func (f *AnthropicFeeder) Feed(event models.ClaudeStreamEvent) error {
+	var data claudeEventData
+	if err := json.Unmarshal(event.Raw, &data); err != nil {
+		return err
+	}
+	switch event.Type {
+	case core.EVENT_MESSAGE_START:
+		f.t.SetUsage(core.TokenCounts(data.Message.Usage))
+	case core.EVENT_CONTENT_BLOCK_START:
+		switch data.ContentBlock.Type {
+		case core.CONTENT_TEXT:
+			f.t.Text(data.ContentBlock.Text)
+		case core.CONTENT_TOOL_USE:
+			f.t.ToolCall(data.Index, data.ContentBlock.ID, data.ContentBlock.Name, "")
+		case core.CONTENT_REDACTED_THINKING:
+			f.t.RedactedThinking(data.ContentBlock.Data)
+		}
+	case core.EVENT_CONTENT_BLOCK_DELTA:
+		switch data.Delta.Type {
+		case core.DELTA_TEXT:
+			f.t.Text(data.Delta.Text)
+		case core.DELTA_INPUT_JSON:
+			f.t.ToolCall(data.Index, "", "", data.Delta.PartialJSON)
+		case core.DELTA_THINKING:
+			f.t.Thinking(data.Delta.Thinking)
+		case core.DELTA_SIGNATURE:
+			f.t.SignThinking(data.Delta.Signature)
+		}
+	case core.EVENT_MESSAGE_DELTA:
+		if data.Delta.StopReason != "" {
+			f.t.SetStopReason(data.Delta.StopReason)
+		}
+		f.t.SetUsage(core.TokenCounts(data.Usage))
+	}
+	return nil
+}
+
+// PipeAnthropicStream feeds every event of an Anthropic upstream into the translator and
+// finishes the Claude message once the upstream stream ends, like PipeOpenAIStream.
+func PipeAnthropicStream(ctx context.Context, stream ClaudeEventReceiver, t *Translator) error {
+	feeder := NewAnthropicFeeder(t)
+	t.Start()
+	for {
+		event, err := stream.Recv()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := feeder.Feed(event); err != nil {
+			return err
+		}
+		if t.Err() != nil {
+			return t.Err()
+		}
+	}
+	t.Finish()
+	return t.Err()
+}
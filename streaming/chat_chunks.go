@@ -0,0 +1,167 @@
+package streaming
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/jiaobendaye/go-claude-code-proxy/conversion"
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+	"github.com/sashabaranov/go-openai"
+)
+
+// ChatChunkWriter is a Sink writing Claude stream events as chat completion chunks, for OpenAI
+// clients. Each tool_use block becomes a tool call with the next tool call index; the finish
+// reason is sent at message_stop, followed by a usage chunk if the client asked for one and
+// "data: [DONE]".
+type ChatChunkWriter struct {
+	w            io.Writer
+	id           string
+	model        string
+	created      int64
+	includeUsage bool
+
+	toolIndexes  map[int]int
+	finishReason openai.FinishReason
+	usage        map[string]int
+}
+
+func NewChatChunkWriter(w io.Writer, id, model string, includeUsage bool) *ChatChunkWriter {
+	return &ChatChunkWriter{
+		w:            w,
+		id:           id,
+		model:        model,
+		created:      time.Now().Unix(),
+		includeUsage: includeUsage,
+		toolIndexes:  map[int]int{},
+		finishReason: openai.FinishReasonStop,
+	}
+}
+
+func (c *ChatChunkWriter) Send(event Event) error {
+	switch event.Type {
+	case core.EVENT_MESSAGE_START:
+		return c.sendDelta(openai.ChatCompletionStreamChoiceDelta{Role: openai.ChatMessageRoleAssistant}, "")
+	case core.EVENT_CONTENT_BLOCK_START:
+		block, _ := event.Data["content_block"].(map[string]any)
+		if block["type"] != core.CONTENT_TOOL_USE {
+			return nil
+		}
+		toolIndex := len(c.toolIndexes)
+		c.toolIndexes[eventIndex(event)] = toolIndex
+		id, _ := block["id"].(string)
+		name, _ := block["name"].(string)
+		return c.sendDelta(openai.ChatCompletionStreamChoiceDelta{ToolCalls: []openai.ToolCall{{
+			Index:    &toolIndex,
+			ID:       id,
+			Type:     openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: name},
+		}}}, "")
+	case core.EVENT_CONTENT_BLOCK_DELTA:
+		return c.sendContentDelta(event)
+	case core.EVENT_MESSAGE_DELTA:
+		if delta, ok := event.Data["delta"].(map[string]any); ok {
+			stopReason, _ := delta["stop_reason"].(string)
+			c.finishReason = conversion.ConvertClaudeStopReason(stopReason)
+		}
+		if usage, ok := event.Data["usage"].(map[string]int); ok {
+			c.usage = usage
+		}
+	case core.EVENT_MESSAGE_STOP:
+		return c.finish()
+	case EVENT_ERROR:
+		errData, _ := event.Data["error"].(map[string]any)
+		data, err := json.Marshal(map[string]any{"error": errData})
+		if err != nil {
+			return err
+		}
+		return c.write(data)
+	}
+	return nil
+}
+
+func (c *ChatChunkWriter) sendContentDelta(event Event) error {
+	delta, _ := event.Data["delta"].(map[string]any)
+	switch delta["type"] {
+	case core.DELTA_TEXT:
+		text, _ := delta["text"].(string)
+		return c.sendDelta(openai.ChatCompletionStreamChoiceDelta{Content: text}, "")
+	case core.DELTA_THINKING:
+		thinking, _ := delta["thinking"].(string)
+		return c.sendDelta(openai.ChatCompletionStreamChoiceDelta{ReasoningContent: thinking}, "")
+	case core.DELTA_INPUT_JSON:
+		toolIndex, ok := c.toolIndexes[eventIndex(event)]
+		if !ok {
+			return nil
+		}
+		arguments, _ := delta["partial_json"].(string)
+		return c.sendDelta(openai.ChatCompletionStreamChoiceDelta{ToolCalls: []openai.ToolCall{{
+			Index:    &toolIndex,
+			Type:     openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Arguments: arguments},
+		}}}, "")
+	}
+	return nil
+}
+
+func (c *ChatChunkWriter) finish() error {
+	if err := c.sendDelta(openai.ChatCompletionStreamChoiceDelta{}, c.finishReason); err != nil {
+		return err
+	}
+	if c.includeUsage {
+		// The usage chunk has no choices, as OpenAI sends it
+		data, err := json.Marshal(c.chunk(nil, conversion.ConvertClaudeUsage(c.usage)))
+		if err != nil {
+			return err
+		}
+		if err := c.write(data); err != nil {
+			return err
+		}
+	}
+	return c.write([]byte("[DONE]"))
+}
+
+func (c *ChatChunkWriter) chunk(choices []openai.ChatCompletionStreamChoice, usage *openai.Usage) openai.ChatCompletionStreamResponse {
+	if choices == nil {
+		choices = []openai.ChatCompletionStreamChoice{}
+	}
+	return openai.ChatCompletionStreamResponse{
+		ID:      c.id,
+		Object:  "chat.completion.chunk",
+		Created: c.created,
+		Model:   c.model,
+		Choices: choices,
+		Usage:   usage,
+	}
+}
+
+func (c *ChatChunkWriter) sendDelta(delta openai.ChatCompletionStreamChoiceDelta, finishReason openai.FinishReason) error {
+	data, err := json.Marshal(c.chunk([]openai.ChatCompletionStreamChoice{{Delta: delta, FinishReason: finishReason}}, nil))
+	if err != nil {
+		return err
+	}
+	return c.write(data)
+}
+
+func (c *ChatChunkWriter) write(data []byte) error {
+	if _, err := io.WriteString(c.w, "data: "); err != nil {
+		return err
+	}
+	if _, err := c.w.Write(data); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(c.w, "\n\n"); err != nil {
+		return err
+	}
+	if flusher, ok := c.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// eventIndex returns the content block index of an event.
+func eventIndex(event Event) int {
+	index, _ := event.Data["index"].(int)
+	return index
+}
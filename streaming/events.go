@@ -0,0 +1,148 @@
+package streaming
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+)
+
+// EVENT_ERROR is the type of the terminal error event of a Claude stream.
+const EVENT_ERROR = "error"
+
+// ERROR_TYPE_API is the error type of failures the translator reports itself.
+const ERROR_TYPE_API = "api_error"
+
+// Event is one Claude server-sent event.
+type Event struct {
+	Type string
+	Data map[string]any
+}
+
+// Sink receives the events of a Claude stream.
+type Sink interface {
+	Send(event Event) error
+}
+
+// SinkFunc adapts a function to a Sink.
+type SinkFunc func(event Event) error
+
+func (f SinkFunc) Send(event Event) error {
+	return f(event)
+}
+
+// SSEWriter writes events in the text/event-stream format and flushes after each event.
+type SSEWriter struct {
+	w io.Writer
+}
+
+func NewSSEWriter(w io.Writer) *SSEWriter {
+	return &SSEWriter{w: w}
+}
+
+func (s *SSEWriter) Send(event Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	return s.SendRaw(event.Type, data)
+}
+
+// SendRaw writes an event whose data is already encoded, for relaying upstream Claude streams.
+func (s *SSEWriter) SendRaw(eventType string, data []byte) error {
+	if _, err := io.WriteString(s.w, "event: "+eventType+"\ndata: "); err != nil {
+		return err
+	}
+	if _, err := s.w.Write(data); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(s.w, "\n\n"); err != nil {
+		return err
+	}
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// SetSSEHeaders sets the response headers of a Claude stream.
+func SetSSEHeaders(header http.Header) {
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("Access-Control-Allow-Origin", "*")
+	header.Set("Access-Control-Allow-Headers", "*")
+}
+
+func messageStartEvent(messageID, model string) Event {
+	return Event{Type: core.EVENT_MESSAGE_START, Data: map[string]any{
+		"type": core.EVENT_MESSAGE_START,
+		"message": map[string]any{
+			"id":            messageID,
+			"type":          "message",
+			"role":          core.ROLE_ASSISTANT,
+			"model":         model,
+			"content":       []any{},
+			"stop_reason":   nil,
+			"stop_sequence": nil,
+			"usage": map[string]int{
+				"input_tokens":  0,
+				"output_tokens": 0,
+			},
+		},
+	}}
+}
+
+func pingEvent() Event {
+	return Event{Type: core.EVENT_PING, Data: map[string]any{"type": core.EVENT_PING}}
+}
+
+func contentBlockStartEvent(index int, contentBlock map[string]any) Event {
+	return Event{Type: core.EVENT_CONTENT_BLOCK_START, Data: map[string]any{
+		"type":          core.EVENT_CONTENT_BLOCK_START,
+		"index":         index,
+		"content_block": contentBlock,
+	}}
+}
+
+func contentBlockDeltaEvent(index int, delta map[string]any) Event {
+	return Event{Type: core.EVENT_CONTENT_BLOCK_DELTA, Data: map[string]any{
+		"type":  core.EVENT_CONTENT_BLOCK_DELTA,
+		"index": index,
+		"delta": delta,
+	}}
+}
+
+func contentBlockStopEvent(index int) Event {
+	return Event{Type: core.EVENT_CONTENT_BLOCK_STOP, Data: map[string]any{
+		"type":  core.EVENT_CONTENT_BLOCK_STOP,
+		"index": index,
+	}}
+}
+
+func messageDeltaEvent(stopReason string, usage map[string]int) Event {
+	return Event{Type: core.EVENT_MESSAGE_DELTA, Data: map[string]any{
+		"type": core.EVENT_MESSAGE_DELTA,
+		"delta": map[string]any{
+			"stop_reason":   stopReason,
+			"stop_sequence": nil,
+		},
+		"usage": usage,
+	}}
+}
+
+func messageStopEvent() Event {
+	return Event{Type: core.EVENT_MESSAGE_STOP, Data: map[string]any{"type": core.EVENT_MESSAGE_STOP}}
+}
+
+// ErrorEvent builds the terminal error event from an Anthropic error type and message.
+func ErrorEvent(errType, message string) Event {
+	return Event{Type: EVENT_ERROR, Data: map[string]any{
+		"type": EVENT_ERROR,
+		"error": map[string]any{
+			"type":    errType,
+			"message": message,
+		},
+	}}
+}
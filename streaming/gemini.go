@@ -0,0 +1,112 @@
+package streaming
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/jiaobendaye/go-claude-code-proxy/conversion"
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+	"github.com/jiaobendaye/go-claude-code-proxy/models"
+	"github.com/sashabaranov/go-openai"
+)
+
+// GeminiChunkReceiver is implemented by streamGenerateContent streams.
+type GeminiChunkReceiver interface {
+	Recv() (models.GeminiResponse, error)
+}
+
+// GeminiFeeder applies streamGenerateContent chunks to a translator. Gemini sends every function
+// call whole in one part, each gets the next tool index.
+type GeminiFeeder struct {
+	t     *Translator
+	route core.Route
+
+	toolIndex int
+}
+
+func NewGeminiFeeder(t *Translator, route core.Route) *GeminiFeeder {
+	return &GeminiFeeder{t: t, route: route}
+}
+
+// Feed applies one chunk. Error chunks are returned as an openai.APIError without status code,
+// like errors inside chat completion streams.
+func (f *GeminiFeeder) Feed(chunk models.GeminiResponse) error {
+	if chunk.Error != nil {
+		return &openai.APIError{Code: chunk.Error.Code, Type: chunk.Error.Status, Message: chunk.Error.Message}
+	}
+	if chunk.UsageMetadata != nil {
+		f.t.SetUsage(conversion.ConvertGeminiUsage(chunk.UsageMetadata))
+	}
+	if chunk.PromptFeedback != nil && chunk.PromptFeedback.BlockReason != "" {
+		f.t.SetStopReason(core.STOP_REFUSAL)
+	}
+	if len(chunk.Candidates) == 0 {
+		return nil
+	}
+
+	candidate := chunk.Candidates[0]
+	for _, part := range candidate.Content.Parts {
+		if part.Thought {
+			f.t.Thinking(part.Text)
+			f.sign(part.ThoughtSignature)
+			continue
+		}
+		// A signature on regular content belongs to the reasoning that preceded it
+		f.sign(part.ThoughtSignature)
+		switch {
+		case part.FunctionCall != nil:
+			args := "{}"
+			if part.FunctionCall.Args != nil {
+				if encoded, err := json.Marshal(part.FunctionCall.Args); err == nil {
+					args = string(encoded)
+				}
+			}
+			f.t.ToolCall(f.toolIndex, conversion.GeminiToolUseID(part.FunctionCall), part.FunctionCall.Name, args)
+			f.toolIndex++
+		case part.Text != "":
+			f.t.Text(part.Text)
+		}
+	}
+	if candidate.FinishReason != "" {
+		f.t.SetStopReason(conversion.ConvertGeminiStopReason(candidate.FinishReason, f.toolIndex > 0))
+	}
+	return nil
+}
+
+func (f *GeminiFeeder) sign(thoughtSignature string) {
+	if thoughtSignature == "" {
+		return
+	}
+	signature := conversion.ThoughtSignature(f.route, thoughtSignature)
+	if !f.t.SignThinking(signature) {
+		f.t.RedactedThinking(signature)
+	}
+}
+
+// PipeGeminiStream feeds every chunk of a streamGenerateContent stream into the translator and
+// finishes the Claude message once the upstream stream ends, like PipeOpenAIStream.
+func PipeGeminiStream(ctx context.Context, stream GeminiChunkReceiver, t *Translator, route core.Route) error {
+	feeder := NewGeminiFeeder(t, route)
+	t.Start()
+	for {
+		chunk, err := stream.Recv()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := feeder.Feed(chunk); err != nil {
+			return err
+		}
+		if t.Err() != nil {
+			return t.Err()
+		}
+	}
+	t.Finish()
+	return t.Err()
+}
@@ -0,0 +1,80 @@
+package streaming
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/jiaobendaye/go-claude-code-proxy/conversion"
+	"github.com/jiaobendaye/go-claude-code-proxy/models"
+	"github.com/sashabaranov/go-openai"
+)
+
+// OllamaChunkReceiver is implemented by streamed /api/chat responses.
+type OllamaChunkReceiver interface {
+	Recv() (models.OllamaChatResponse, error)
+}
+
+// OllamaFeeder applies the lines of a streamed /api/chat response to a translator. Ollama sends
+// tool calls whole, each gets the next tool index.
+type OllamaFeeder struct {
+	t *Translator
+
+	toolIndex int
+}
+
+func NewOllamaFeeder(t *Translator) *OllamaFeeder {
+	return &OllamaFeeder{t: t}
+}
+
+// Feed applies one line. Error lines are returned as an openai.APIError without status code,
+// like errors inside chat completion streams.
+func (f *OllamaFeeder) Feed(chunk models.OllamaChatResponse) error {
+	if chunk.Error != "" {
+		return &openai.APIError{Message: chunk.Error}
+	}
+	f.t.Thinking(chunk.Message.Thinking)
+	f.t.Text(chunk.Message.Content)
+	for _, toolCall := range chunk.Message.ToolCalls {
+		args := "{}"
+		if toolCall.Function.Arguments != nil {
+			if encoded, err := json.Marshal(toolCall.Function.Arguments); err == nil {
+				args = string(encoded)
+			}
+		}
+		f.t.ToolCall(f.toolIndex, conversion.OllamaToolUseID(toolCall), toolCall.Function.Name, args)
+		f.toolIndex++
+	}
+	if chunk.Done {
+		f.t.SetUsage(conversion.ConvertOllamaUsage(chunk))
+		f.t.SetStopReason(conversion.ConvertOllamaStopReason(chunk.DoneReason, f.toolIndex > 0))
+	}
+	return nil
+}
+
+// PipeOllamaStream feeds every line of a streamed /api/chat response into the translator and
+// finishes the Claude message once the upstream stream ends, like PipeOpenAIStream.
+func PipeOllamaStream(ctx context.Context, stream OllamaChunkReceiver, t *Translator) error {
+	feeder := NewOllamaFeeder(t)
+	t.Start()
+	for {
+		chunk, err := stream.Recv()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := feeder.Feed(chunk); err != nil {
+			return err
+		}
+		if t.Err() != nil {
+			return t.Err()
+		}
+	}
+	t.Finish()
+	return t.Err()
+}
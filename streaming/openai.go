@@ -0,0 +1,71 @@
+package streaming
+
+import (
+	"context"
+	"io"
+
+	"github.com/jiaobendaye/go-claude-code-proxy/conversion"
+	"github.com/sashabaranov/go-openai"
+)
+
+// ChunkReceiver is implemented by go-openai chat completion streams.
+type ChunkReceiver interface {
+	Recv() (openai.ChatCompletionStreamResponse, error)
+}
+
+// FeedOpenAIChunk applies one chat completion chunk to the translator.
+func FeedOpenAIChunk(t *Translator, chunk openai.ChatCompletionStreamResponse) {
+	// With stream_options.include_usage the usage arrives in a last chunk without choices
+	if chunk.Usage != nil {
+		usage := map[string]int{
+			"input_tokens":  chunk.Usage.PromptTokens,
+			"output_tokens": chunk.Usage.CompletionTokens,
+		}
+		if chunk.Usage.PromptTokensDetails != nil {
+			usage["cache_read_input_tokens"] = chunk.Usage.PromptTokensDetails.CachedTokens
+		}
+		t.SetUsage(usage)
+	}
+
+	if len(chunk.Choices) == 0 {
+		return
+	}
+	choice := chunk.Choices[0]
+	t.Thinking(choice.Delta.ReasoningContent)
+	t.Text(choice.Delta.Content)
+	for _, toolCall := range choice.Delta.ToolCalls {
+		toolCallIndex := 0
+		if toolCall.Index != nil {
+			toolCallIndex = *toolCall.Index
+		}
+		t.ToolCall(toolCallIndex, toolCall.ID, toolCall.Function.Name, toolCall.Function.Arguments)
+	}
+	if choice.FinishReason != "" {
+		t.SetStopReason(conversion.ConvertFinishReason(choice.FinishReason))
+	}
+}
+
+// PipeOpenAIStream feeds every chunk of an OpenAI stream into the translator and finishes
+// the Claude message once the upstream stream ends. Upstream and context errors are returned
+// without emitting anything, so the caller can report them in its own error format.
+func PipeOpenAIStream(ctx context.Context, stream ChunkReceiver, t *Translator) error {
+	t.Start()
+	for {
+		chunk, err := stream.Recv()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		FeedOpenAIChunk(t, chunk)
+		if t.Err() != nil {
+			return t.Err()
+		}
+	}
+	t.Finish()
+	return t.Err()
+}
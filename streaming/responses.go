@@ -0,0 +1,116 @@
+package streaming
+
+import (
+	"context"
+	"io"
+
+	"github.com/jiaobendaye/go-claude-code-proxy/conversion"
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+	"github.com/jiaobendaye/go-claude-code-proxy/models"
+	"github.com/sashabaranov/go-openai"
+)
+
+// ResponsesEventReceiver is implemented by streams of Responses API events.
+type ResponsesEventReceiver interface {
+	Recv() (models.ResponsesStreamEvent, error)
+}
+
+// ResponsesFeeder applies Responses API stream events to a translator. Output items are keyed by
+// their output_index, which stands in for the tool call index of chat completion streams.
+type ResponsesFeeder struct {
+	t     *Translator
+	route core.Route
+
+	calledTools bool
+	// summarized records reasoning items whose summary went out as a thinking block
+	summarized map[int]bool
+}
+
+func NewResponsesFeeder(t *Translator, route core.Route) *ResponsesFeeder {
+	return &ResponsesFeeder{t: t, route: route, summarized: map[int]bool{}}
+}
+
+// Feed applies one event. Failures reported by the upstream inside the stream are returned as
+// an openai.APIError without status code, like errors inside chat completion streams.
+func (f *ResponsesFeeder) Feed(event models.ResponsesStreamEvent) error {
+	switch event.Type {
+	case models.RESPONSES_EVENT_OUTPUT_ITEM_ADDED:
+		if event.Item != nil && event.Item.Type == models.RESPONSES_ITEM_FUNCTION_CALL {
+			f.calledTools = true
+			f.t.ToolCall(event.OutputIndex, event.Item.CallID, event.Item.Name, event.Item.Arguments)
+		}
+	case models.RESPONSES_EVENT_OUTPUT_TEXT_DELTA, models.RESPONSES_EVENT_REFUSAL_DELTA:
+		f.t.Text(event.Delta)
+	case models.RESPONSES_EVENT_FUNCTION_ARGUMENTS_DELTA:
+		f.t.ToolCall(event.OutputIndex, "", "", event.Delta)
+	case models.RESPONSES_EVENT_REASONING_SUMMARY_PART:
+		if event.SummaryIndex > 0 {
+			f.t.Thinking("\n\n")
+		}
+	case models.RESPONSES_EVENT_REASONING_SUMMARY_DELTA:
+		f.summarized[event.OutputIndex] = f.summarized[event.OutputIndex] || event.Delta != ""
+		f.t.Thinking(event.Delta)
+	case models.RESPONSES_EVENT_OUTPUT_ITEM_DONE:
+		// The encrypted reasoning only arrives with the finished item, it ends the thinking block
+		if event.Item != nil && event.Item.Type == models.RESPONSES_ITEM_REASONING {
+			signature := conversion.ReasoningSignature(f.route, *event.Item)
+			if f.summarized[event.OutputIndex] {
+				f.t.SignThinking(signature)
+			} else if event.Item.EncryptedContent != "" {
+				f.t.RedactedThinking(signature)
+			}
+		}
+	case models.RESPONSES_EVENT_COMPLETED, models.RESPONSES_EVENT_INCOMPLETE:
+		if event.Response != nil {
+			f.t.SetUsage(conversion.ConvertResponsesUsage(event.Response.Usage))
+		}
+		f.t.SetStopReason(conversion.ConvertResponsesStopReason(event.Response, f.calledTools))
+	case models.RESPONSES_EVENT_FAILED, models.RESPONSES_EVENT_ERROR:
+		return ResponsesEventError(event)
+	}
+	return nil
+}
+
+// ResponsesEventError returns the failure reported by an error or response.failed event as an
+// openai.APIError without status code, or nil for other events.
+func ResponsesEventError(event models.ResponsesStreamEvent) *openai.APIError {
+	switch event.Type {
+	case models.RESPONSES_EVENT_FAILED:
+		message := "response failed"
+		var code any
+		if event.Response != nil && event.Response.Error != nil {
+			message, code = event.Response.Error.Message, event.Response.Error.Code
+		}
+		return &openai.APIError{Code: code, Message: message}
+	case models.RESPONSES_EVENT_ERROR:
+		return &openai.APIError{Code: event.Code, Message: event.Message}
+	}
+	return nil
+}
+
+// PipeResponsesStream feeds every event of a Responses API stream into the translator and
+// finishes the Claude message once the upstream stream ends, like PipeOpenAIStream.
+func PipeResponsesStream(ctx context.Context, stream ResponsesEventReceiver, t *Translator, route core.Route) error {
+	feeder := NewResponsesFeeder(t, route)
+	t.Start()
+	for {
+		event, err := stream.Recv()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := feeder.Feed(event); err != nil {
+			return err
+		}
+		if t.Err() != nil {
+			return t.Err()
+		}
+	}
+	t.Finish()
+	return t.Err()
+}
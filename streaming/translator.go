@@ -0,0 +1,349 @@
+package streaming
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+)
+
+type translatorState int
+
+const (
+	stateIdle translatorState = iota
+	stateStarted
+	// stateFinishing closes the last blocks, the upstream output has ended
+	stateFinishing
+	stateFinished
+)
+
+// toolCall tracks one upstream tool call, keyed by the upstream tool call index.
+type toolCall struct {
+	id   string
+	name string
+	// args accumulates the full arguments for validation at close, pending holds fragments
+	// received before the block could be opened
+	args    strings.Builder
+	pending strings.Builder
+	index   int
+	opened  bool
+	closed  bool
+}
+
+// openBlock is the content block currently open on the Claude side.
+type openBlock struct {
+	index  int
+	kind   string
+	tool   *toolCall
+	signed bool
+}
+
+// Translator is the state machine turning upstream deltas into Claude stream events.
+// Claude streams content blocks strictly one after another: every block gets the next index,
+// is opened by content_block_start, receives deltas of its own type and is closed by
+// content_block_stop before the next block starts. Upstream deltas of a different kind than
+// the open block close it and open a new one.
+type Translator struct {
+	sink      Sink
+	messageID string
+	model     string
+
+	state     translatorState
+	nextIndex int
+	open      *openBlock
+	tools     map[int]*toolCall
+
+	thinkingSignature string
+	stopReason        string
+	usage             map[string]int
+	err               error
+}
+
+func NewTranslator(sink Sink, messageID, model string) *Translator {
+	return &Translator{
+		sink:       sink,
+		messageID:  messageID,
+		model:      model,
+		tools:      map[int]*toolCall{},
+		stopReason: core.STOP_END_TURN,
+		usage: map[string]int{
+			"input_tokens":  0,
+			"output_tokens": 0,
+		},
+	}
+}
+
+// Err returns the first error of the sink, after which the translator drops all events.
+func (t *Translator) Err() error {
+	return t.err
+}
+
+func (t *Translator) send(event Event) {
+	if t.err != nil || t.state == stateFinished {
+		return
+	}
+	t.err = t.sink.Send(event)
+}
+
+// Start emits message_start and a ping. It is implied by the first delta if not called.
+func (t *Translator) Start() {
+	if t.state != stateIdle {
+		return
+	}
+	t.state = stateStarted
+	t.send(messageStartEvent(t.messageID, t.model))
+	t.send(pingEvent())
+}
+
+// Ping keeps the connection alive during long upstream pauses.
+func (t *Translator) Ping() {
+	if t.state == stateStarted {
+		t.send(pingEvent())
+	}
+}
+
+func (t *Translator) closeOpenBlock() {
+	if t.open == nil {
+		return
+	}
+	if tool := t.open.tool; tool != nil {
+		tool.closed = true
+		if err := t.completeToolArgs(tool); err != nil {
+			log.Printf("Tool call %s (%s) has invalid arguments %q: %v", tool.id, tool.name, tool.args.String(), err)
+			t.open = nil
+			t.Error(ERROR_TYPE_API, err.Error())
+			return
+		}
+	}
+	if t.open.kind == core.CONTENT_THINKING && !t.open.signed && t.thinkingSignature != "" {
+		t.send(contentBlockDeltaEvent(t.open.index, map[string]any{"type": core.DELTA_SIGNATURE, "signature": t.thinkingSignature}))
+	}
+	t.send(contentBlockStopEvent(t.open.index))
+	t.open = nil
+}
+
+func (t *Translator) openNewBlock(kind string, contentBlock map[string]any) *openBlock {
+	t.closeOpenBlock()
+	t.open = &openBlock{index: t.nextIndex, kind: kind}
+	t.nextIndex++
+	t.send(contentBlockStartEvent(t.open.index, contentBlock))
+	return t.open
+}
+
+// Text appends assistant text, opening a text block if needed.
+func (t *Translator) Text(text string) {
+	if text == "" || t.state == stateFinished {
+		return
+	}
+	t.Start()
+	if t.open == nil || t.open.kind != core.CONTENT_TEXT {
+		t.openNewBlock(core.CONTENT_TEXT, map[string]any{"type": core.CONTENT_TEXT, "text": ""})
+	}
+	t.send(contentBlockDeltaEvent(t.open.index, map[string]any{"type": core.DELTA_TEXT, "text": text}))
+}
+
+// Thinking appends reasoning text, opening a thinking block if needed.
+func (t *Translator) Thinking(thinking string) {
+	if thinking == "" || t.state == stateFinished {
+		return
+	}
+	t.Start()
+	if t.open == nil || t.open.kind != core.CONTENT_THINKING {
+		t.openNewBlock(core.CONTENT_THINKING, map[string]any{"type": core.CONTENT_THINKING, "thinking": ""})
+	}
+	t.send(contentBlockDeltaEvent(t.open.index, map[string]any{"type": core.DELTA_THINKING, "thinking": thinking}))
+}
+
+// SignThinking ends the open thinking block with its own signature, for upstreams producing a
+// signature per reasoning item. It reports false when no thinking block was open.
+func (t *Translator) SignThinking(signature string) bool {
+	if t.open == nil || t.open.kind != core.CONTENT_THINKING || t.open.signed {
+		return false
+	}
+	t.send(contentBlockDeltaEvent(t.open.index, map[string]any{"type": core.DELTA_SIGNATURE, "signature": signature}))
+	t.open.signed = true
+	t.closeOpenBlock()
+	return true
+}
+
+// RedactedThinking emits a redacted_thinking block, which carries its data in the start event.
+func (t *Translator) RedactedThinking(data string) {
+	if data == "" || t.state == stateFinished {
+		return
+	}
+	t.Start()
+	t.openNewBlock(core.CONTENT_REDACTED_THINKING, map[string]any{"type": core.CONTENT_REDACTED_THINKING, "data": data})
+	t.closeOpenBlock()
+}
+
+// ToolCall feeds a fragment of the upstream tool call with the given index. id and name are
+// usually only present in the first fragment. The tool_use block opens once the name is known and
+// no other tool_use block is open with arguments still incomplete: calls streamed in parallel are
+// held back, arguments and all, until the open one is whole or the message ends, so no call is
+// closed while its fragments may still arrive.
+func (t *Translator) ToolCall(upstreamIndex int, id, name, arguments string) {
+	if t.state == stateFinished {
+		return
+	}
+	t.Start()
+	tool, ok := t.tools[upstreamIndex]
+	if !ok {
+		tool = &toolCall{}
+		t.tools[upstreamIndex] = tool
+	}
+	if id != "" && !tool.opened {
+		tool.id = id
+	}
+	if name != "" && !tool.opened {
+		tool.name = name
+	}
+
+	if tool.closed {
+		// The call was ended by another block and its input already validated, going on would
+		// run the tool with truncated arguments
+		if strings.TrimSpace(arguments) != "" {
+			log.Printf("Arguments of tool call %s (%s) arrived after its block closed", tool.id, tool.name)
+			t.Error(ERROR_TYPE_API, fmt.Sprintf("upstream sent arguments of tool call %s after it ended", tool.name))
+		}
+		return
+	}
+	tool.args.WriteString(arguments)
+	if tool.opened {
+		t.sendToolArgs(tool, arguments)
+	} else {
+		tool.pending.WriteString(arguments)
+	}
+
+	if !tool.opened && tool.name != "" && (t.open == nil || t.open.tool == nil || t.open.tool.complete()) {
+		t.openToolBlock(tool)
+	}
+}
+
+// complete reports whether the arguments of a tool call form a whole JSON object, which no further
+// fragment but whitespace can extend.
+func (tool *toolCall) complete() bool {
+	var input map[string]any
+	return json.Unmarshal([]byte(tool.args.String()), &input) == nil
+}
+
+// openToolBlock opens the tool_use block of a named tool call and sends the arguments received so far.
+func (t *Translator) openToolBlock(tool *toolCall) {
+	if tool.id == "" {
+		tool.id = "toolu_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+	}
+	block := t.openNewBlock(core.CONTENT_TOOL_USE, map[string]any{
+		"type":  core.CONTENT_TOOL_USE,
+		"id":    tool.id,
+		"name":  tool.name,
+		"input": map[string]any{},
+	})
+	block.tool = tool
+	tool.index = block.index
+	tool.opened = true
+	t.sendToolArgs(tool, tool.pending.String())
+	tool.pending.Reset()
+}
+
+// sendToolArgs forwards an argument fragment of an open tool call as an input_json_delta.
+func (t *Translator) sendToolArgs(tool *toolCall, fragment string) {
+	if fragment == "" {
+		return
+	}
+	t.send(contentBlockDeltaEvent(tool.index, map[string]any{"type": core.DELTA_INPUT_JSON, "partial_json": fragment}))
+}
+
+// completeToolArgs validates the arguments streamed for a tool call before its block closes.
+// Fragments already sent can't be taken back, so arguments cut off by the end of the output are
+// completed by a final delta. Arguments that can't be completed into a JSON object, or that are
+// incomplete when another block starts, are an error.
+func (t *Translator) completeToolArgs(tool *toolCall) error {
+	args := tool.args.String()
+	var input map[string]any
+	if json.Unmarshal([]byte(args), &input) == nil {
+		return nil
+	}
+	if t.state != stateFinishing {
+		// Another block started while the arguments were incomplete, their rest may still come
+		return fmt.Errorf("upstream interrupted the arguments of tool %s", tool.name)
+	}
+	suffix, ok := core.CompleteJSONObject(args)
+	if !ok {
+		return fmt.Errorf("upstream returned invalid arguments for tool %s", tool.name)
+	}
+	if strings.TrimSpace(args) != "" {
+		log.Printf("Completing truncated arguments of tool call %s (%s) with %q", tool.id, tool.name, suffix)
+	}
+	t.sendToolArgs(tool, suffix)
+	return nil
+}
+
+// SetThinkingSignature sets the signature sent at the end of thinking blocks that SignThinking
+// did not sign.
+func (t *Translator) SetThinkingSignature(signature string) {
+	t.thinkingSignature = signature
+}
+
+// SetStopReason records the Claude stop reason reported at the end of the message.
+func (t *Translator) SetStopReason(stopReason string) {
+	t.stopReason = stopReason
+}
+
+// SetUsage records token usage. Keys follow the Claude usage object.
+func (t *Translator) SetUsage(usage map[string]int) {
+	for key, value := range usage {
+		t.usage[key] = value
+	}
+}
+
+// Finish closes the open block and ends the message with message_delta and message_stop.
+func (t *Translator) Finish() {
+	if t.state == stateFinished {
+		return
+	}
+	t.Start()
+	t.state = stateFinishing
+	t.closeOpenBlock()
+	if t.state == stateFinished {
+		return
+	}
+
+	// Tool calls held back behind another one are complete now; those that never got a name
+	// cannot be expressed as tool_use blocks
+	indexes := make([]int, 0, len(t.tools))
+	for upstreamIndex := range t.tools {
+		indexes = append(indexes, upstreamIndex)
+	}
+	sort.Ints(indexes)
+	for _, upstreamIndex := range indexes {
+		tool := t.tools[upstreamIndex]
+		if tool.opened {
+			continue
+		}
+		if tool.name == "" {
+			log.Printf("Dropping tool call %d without name", upstreamIndex)
+			continue
+		}
+		t.openToolBlock(tool)
+		t.closeOpenBlock()
+		if t.state == stateFinished {
+			return
+		}
+	}
+
+	t.send(messageDeltaEvent(t.stopReason, t.usage))
+	t.send(messageStopEvent())
+	t.state = stateFinished
+}
+
+// Error terminates the stream with an error event.
+func (t *Translator) Error(errType, message string) {
+	if t.state == stateFinished {
+		return
+	}
+	t.send(ErrorEvent(errType, message))
+	t.state = stateFinished
+}
@@ -0,0 +1,276 @@
+package streaming
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+	"github.com/sashabaranov/go-openai"
+)
+
+// recordedStream replays chat completion chunks recorded from an upstream, then ends with err,
+// or io.EOF when it is nil.
+type recordedStream struct {
+	t      *testing.T
+	chunks []string
+	err    error
+}
+
+func (s *recordedStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	var chunk openai.ChatCompletionStreamResponse
+	if len(s.chunks) == 0 {
+		if s.err != nil {
+			return chunk, s.err
+		}
+		return chunk, io.EOF
+	}
+	if err := json.Unmarshal([]byte(s.chunks[0]), &chunk); err != nil {
+		s.t.Fatalf("invalid recorded chunk %s: %v", s.chunks[0], err)
+	}
+	s.chunks = s.chunks[1:]
+	return chunk, nil
+}
+
+// translateRecorded pipes recorded chunks through a translator checked by the validator, ending
+// with an error event on upstream errors like the endpoints do, and returns the events sent.
+func translateRecorded(t *testing.T, chunks []string, upstreamErr error) []string {
+	t.Helper()
+	var events []string
+	sink := SinkFunc(func(event Event) error {
+		if event.Type != core.EVENT_PING {
+			events = append(events, describeEvent(event))
+		}
+		return nil
+	})
+	translator := NewTranslator(NewValidator(sink), "msg_test", "claude-test")
+	stream := &recordedStream{t: t, chunks: chunks, err: upstreamErr}
+	if err := PipeOpenAIStream(context.Background(), stream, translator); err != nil && translator.Err() == nil {
+		translator.Error(ERROR_TYPE_API, err.Error())
+	}
+	if err := translator.Err(); err != nil {
+		t.Fatalf("the translator produced an invalid stream: %v\nevents: %q", err, events)
+	}
+	return events
+}
+
+// describeEvent summarizes an event on one line.
+func describeEvent(event Event) string {
+	switch event.Type {
+	case core.EVENT_CONTENT_BLOCK_START:
+		block := event.Data["content_block"].(map[string]any)
+		if block["type"] == core.CONTENT_TOOL_USE {
+			return fmt.Sprintf("start %v tool_use %v", event.Data["index"], block["name"])
+		}
+		return fmt.Sprintf("start %v %v", event.Data["index"], block["type"])
+	case core.EVENT_CONTENT_BLOCK_DELTA:
+		delta := event.Data["delta"].(map[string]any)
+		for _, key := range []string{"text", "thinking", "partial_json", "signature"} {
+			if value, ok := delta[key]; ok {
+				return fmt.Sprintf("delta %v %v %v", event.Data["index"], delta["type"], value)
+			}
+		}
+	case core.EVENT_CONTENT_BLOCK_STOP:
+		return fmt.Sprintf("stop %v", event.Data["index"])
+	case core.EVENT_MESSAGE_DELTA:
+		delta := event.Data["delta"].(map[string]any)
+		return fmt.Sprintf("message_delta %v", delta["stop_reason"])
+	case EVENT_ERROR:
+		errorData := event.Data["error"].(map[string]any)
+		return fmt.Sprintf("error %v: %v", errorData["type"], errorData["message"])
+	}
+	return event.Type
+}
+
+func TestTranslatorRecordedStreams(t *testing.T) {
+	tests := []struct {
+		name        string
+		chunks      []string
+		upstreamErr error
+		want        []string
+	}{
+		{
+			name: "text only",
+			chunks: []string{
+				`{"choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}`,
+				`{"choices":[{"index":0,"delta":{"content":"Hel"}}]}`,
+				`{"choices":[{"index":0,"delta":{"content":"lo"}}]}`,
+				`{"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+				`{"choices":[],"usage":{"prompt_tokens":9,"completion_tokens":2,"total_tokens":11}}`,
+			},
+			want: []string{
+				"message_start",
+				"start 0 text", "delta 0 text_delta Hel", "delta 0 text_delta lo", "stop 0",
+				"message_delta end_turn", "message_stop",
+			},
+		},
+		{
+			name: "thinking then text",
+			chunks: []string{
+				`{"choices":[{"index":0,"delta":{"role":"assistant","reasoning_content":"Let me"}}]}`,
+				`{"choices":[{"index":0,"delta":{"reasoning_content":" think."}}]}`,
+				`{"choices":[{"index":0,"delta":{"content":"Done."}}]}`,
+				`{"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+			},
+			want: []string{
+				"message_start",
+				"start 0 thinking", "delta 0 thinking_delta Let me", "delta 0 thinking_delta  think.", "stop 0",
+				"start 1 text", "delta 1 text_delta Done.", "stop 1",
+				"message_delta end_turn", "message_stop",
+			},
+		},
+		{
+			name: "parallel tool calls",
+			chunks: []string{
+				`{"choices":[{"index":0,"delta":{"content":"Reading both."}}]}`,
+				`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"Read","arguments":""}}]}}]}`,
+				`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"path\":\"a.go\"}"}}]}}]}`,
+				`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_b","type":"function","function":{"name":"Read","arguments":"{\"path\":"}}]}}]}`,
+				`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"function":{"arguments":"\"b.go\"}"}}]}}]}`,
+				`{"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+			},
+			want: []string{
+				"message_start",
+				"start 0 text", "delta 0 text_delta Reading both.", "stop 0",
+				"start 1 tool_use Read", `delta 1 input_json_delta {"path":"a.go"}`, "stop 1",
+				"start 2 tool_use Read", `delta 2 input_json_delta {"path":`, `delta 2 input_json_delta "b.go"}`, "stop 2",
+				"message_delta tool_use", "message_stop",
+			},
+		},
+		{
+			name: "truncated stream",
+			chunks: []string{
+				`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"Write","arguments":"{\"path\":\"a.go\",\"content\":\"pack"}}]}}]}`,
+				`{"choices":[{"index":0,"delta":{},"finish_reason":"length"}]}`,
+			},
+			want: []string{
+				"message_start",
+				"start 0 tool_use Write", `delta 0 input_json_delta {"path":"a.go","content":"pack`, `delta 0 input_json_delta "}`, "stop 0",
+				"message_delta max_tokens", "message_stop",
+			},
+		},
+		{
+			name: "upstream error mid-stream",
+			chunks: []string{
+				`{"choices":[{"index":0,"delta":{"content":"Partial"}}]}`,
+			},
+			upstreamErr: errors.New("connection reset"),
+			want: []string{
+				"message_start",
+				"start 0 text", "delta 0 text_delta Partial",
+				"error api_error: connection reset",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := translateRecorded(t, tt.chunks, tt.upstreamErr)
+			if !reflect.DeepEqual(events, tt.want) {
+				t.Errorf("events = %q\nwant %q", events, tt.want)
+			}
+		})
+	}
+}
+
+func TestTranslatorToolCallArguments(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   []string
+	}{
+		{
+			name: "interleaved parallel calls",
+			chunks: []string{
+				`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"Read","arguments":"{\"pa"}}]}}]}`,
+				`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_b","type":"function","function":{"name":"Grep","arguments":"{\"pattern\":"}}]}}]}`,
+				`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"th\":\"a.go\"}"}}]}}]}`,
+				`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"function":{"arguments":"\"TODO\"}"}}]}}]}`,
+				`{"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+			},
+			want: []string{
+				"message_start",
+				"start 0 tool_use Read", `delta 0 input_json_delta {"pa`, `delta 0 input_json_delta th":"a.go"}`, "stop 0",
+				"start 1 tool_use Grep", `delta 1 input_json_delta {"pattern":"TODO"}`, "stop 1",
+				"message_delta tool_use", "message_stop",
+			},
+		},
+		{
+			name: "sequential calls stream as they come",
+			chunks: []string{
+				`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"Read","arguments":"{\"path\":\"a.go\"}"}}]}}]}`,
+				`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_b","type":"function","function":{"name":"Read","arguments":"{\"path\":"}}]}}]}`,
+				`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"function":{"arguments":"\"b.go\"}"}}]}}]}`,
+			},
+			want: []string{
+				"message_start",
+				"start 0 tool_use Read", `delta 0 input_json_delta {"path":"a.go"}`, "stop 0",
+				"start 1 tool_use Read", `delta 1 input_json_delta {"path":`, `delta 1 input_json_delta "b.go"}`, "stop 1",
+				"message_delta end_turn", "message_stop",
+			},
+		},
+		{
+			name: "held back call cut off at the end",
+			chunks: []string{
+				`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"Read","arguments":"{\"path\":\"a"}}]}}]}`,
+				`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_b","type":"function","function":{"name":"Read","arguments":"{\"path\":\"b"}}]}}]}`,
+				`{"choices":[{"index":0,"delta":{},"finish_reason":"length"}]}`,
+			},
+			want: []string{
+				"message_start",
+				"start 0 tool_use Read", `delta 0 input_json_delta {"path":"a`, `delta 0 input_json_delta "}`, "stop 0",
+				"start 1 tool_use Read", `delta 1 input_json_delta {"path":"b`, `delta 1 input_json_delta "}`, "stop 1",
+				"message_delta max_tokens", "message_stop",
+			},
+		},
+		{
+			name: "arguments interrupted by text",
+			chunks: []string{
+				`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"Read","arguments":"{\"path\":"}}]}}]}`,
+				`{"choices":[{"index":0,"delta":{"content":"Oops"}}]}`,
+			},
+			want: []string{
+				"message_start",
+				"start 0 tool_use Read", `delta 0 input_json_delta {"path":`,
+				"error api_error: upstream interrupted the arguments of tool Read",
+			},
+		},
+		{
+			name: "late arguments for a closed call",
+			chunks: []string{
+				`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"Read","arguments":"{\"path\":\"a.go\"}"}}]}}]}`,
+				`{"choices":[{"index":0,"delta":{"content":"Reading."}}]}`,
+				`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":" "}}]}}]}`,
+				`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":",\"limit\":5"}}]}}]}`,
+			},
+			want: []string{
+				"message_start",
+				"start 0 tool_use Read", `delta 0 input_json_delta {"path":"a.go"}`, "stop 0",
+				"start 1 text", "delta 1 text_delta Reading.",
+				"error api_error: upstream sent arguments of tool call Read after it ended",
+			},
+		},
+		{
+			name: "invalid arguments",
+			chunks: []string{
+				`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"Read","arguments":"{\"path\":\"a.go\",}"}}]}}]}`,
+			},
+			want: []string{
+				"message_start",
+				"start 0 tool_use Read", `delta 0 input_json_delta {"path":"a.go",}`,
+				"error api_error: upstream returned invalid arguments for tool Read",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := translateRecorded(t, tt.chunks, nil)
+			if !reflect.DeepEqual(events, tt.want) {
+				t.Errorf("events = %q\nwant %q", events, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package streaming
+
+import (
+	"fmt"
+
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+)
+
+// deltaTypes lists the delta types each content block type accepts.
+var deltaTypes = map[string][]string{
+	core.CONTENT_TEXT:              {core.DELTA_TEXT},
+	core.CONTENT_TOOL_USE:          {core.DELTA_INPUT_JSON},
+	core.CONTENT_THINKING:          {core.DELTA_THINKING, core.DELTA_SIGNATURE},
+	core.CONTENT_REDACTED_THINKING: {},
+}
+
+// GrammarError reports an event that violates the Claude streaming grammar.
+type GrammarError struct {
+	Position int
+	Event    string
+	Reason   string
+}
+
+func (e *GrammarError) Error() string {
+	return fmt.Sprintf("invalid %s event at position %d: %s", e.Event, e.Position, e.Reason)
+}
+
+// Validator is a Sink enforcing the Claude event grammar before forwarding events:
+//
+//	message_start ping* (content_block_start content_block_delta* content_block_stop ping*)*
+//	message_delta message_stop
+//
+// with block indexes counting up from 0, deltas matching the open block's type and an error
+// event allowed at any point, ending the stream.
+type Validator struct {
+	next Sink
+
+	position  int
+	started   bool
+	delta     bool
+	finished  bool
+	nextIndex int
+	openIndex int
+	openType  string
+}
+
+func NewValidator(next Sink) *Validator {
+	return &Validator{next: next, openIndex: -1}
+}
+
+func (v *Validator) Send(event Event) error {
+	if err := v.check(event); err != nil {
+		return err
+	}
+	v.position++
+	return v.next.Send(event)
+}
+
+func (v *Validator) fail(event Event, format string, args ...any) error {
+	return &GrammarError{Position: v.position, Event: event.Type, Reason: fmt.Sprintf(format, args...)}
+}
+
+func (v *Validator) check(event Event) error {
+	if v.finished {
+		return v.fail(event, "event after end of stream")
+	}
+	if event.Type == EVENT_ERROR {
+		v.finished = true
+		return nil
+	}
+	if !v.started && event.Type != core.EVENT_MESSAGE_START {
+		return v.fail(event, "stream must begin with message_start")
+	}
+
+	switch event.Type {
+	case core.EVENT_MESSAGE_START:
+		if v.started {
+			return v.fail(event, "duplicate message_start")
+		}
+		v.started = true
+	case core.EVENT_PING:
+	case core.EVENT_CONTENT_BLOCK_START:
+		if v.delta {
+			return v.fail(event, "content block after message_delta")
+		}
+		if v.openIndex >= 0 {
+			return v.fail(event, "block %d is still open", v.openIndex)
+		}
+		index, ok := event.Data["index"].(int)
+		if !ok || index != v.nextIndex {
+			return v.fail(event, "expected index %d, got %v", v.nextIndex, event.Data["index"])
+		}
+		block, _ := event.Data["content_block"].(map[string]any)
+		blockType, _ := block["type"].(string)
+		if _, known := deltaTypes[blockType]; !known {
+			return v.fail(event, "unknown content block type %q", blockType)
+		}
+		v.openIndex, v.openType = index, blockType
+		v.nextIndex++
+	case core.EVENT_CONTENT_BLOCK_DELTA:
+		index, _ := event.Data["index"].(int)
+		if v.openIndex < 0 || index != v.openIndex {
+			return v.fail(event, "delta for block %v which is not open", event.Data["index"])
+		}
+		delta, _ := event.Data["delta"].(map[string]any)
+		deltaType, _ := delta["type"].(string)
+		allowed := false
+		for _, candidate := range deltaTypes[v.openType] {
+			allowed = allowed || candidate == deltaType
+		}
+		if !allowed {
+			return v.fail(event, "%s is not valid in a %s block", deltaType, v.openType)
+		}
+	case core.EVENT_CONTENT_BLOCK_STOP:
+		index, _ := event.Data["index"].(int)
+		if v.openIndex < 0 || index != v.openIndex {
+			return v.fail(event, "stop for block %v which is not open", event.Data["index"])
+		}
+		v.openIndex, v.openType = -1, ""
+	case core.EVENT_MESSAGE_DELTA:
+		if v.openIndex >= 0 {
+			return v.fail(event, "block %d is still open", v.openIndex)
+		}
+		if v.delta {
+			return v.fail(event, "duplicate message_delta")
+		}
+		v.delta = true
+	case core.EVENT_MESSAGE_STOP:
+		if !v.delta {
+			return v.fail(event, "message_stop without message_delta")
+		}
+		v.finished = true
+	default:
+		return v.fail(event, "unknown event type")
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package streaming
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+)
+
+func TestValidatorRejectsInvalidStreams(t *testing.T) {
+	start := messageStartEvent("msg_test", "claude-test")
+	textBlock := map[string]any{"type": core.CONTENT_TEXT, "text": ""}
+	textDelta := map[string]any{"type": core.DELTA_TEXT, "text": "hi"}
+	tests := []struct {
+		name   string
+		events []Event
+	}{
+		{name: "no message_start", events: []Event{contentBlockStartEvent(0, textBlock)}},
+		{name: "duplicate message_start", events: []Event{start, start}},
+		{name: "index gap", events: []Event{start, contentBlockStartEvent(1, textBlock)}},
+		{name: "overlapping blocks", events: []Event{start, contentBlockStartEvent(0, textBlock), contentBlockStartEvent(1, textBlock)}},
+		{name: "delta of another type", events: []Event{start, contentBlockStartEvent(0, textBlock),
+			contentBlockDeltaEvent(0, map[string]any{"type": core.DELTA_INPUT_JSON, "partial_json": "{}"})}},
+		{name: "delta after stop", events: []Event{start, contentBlockStartEvent(0, textBlock), contentBlockStopEvent(0), contentBlockDeltaEvent(0, textDelta)}},
+		{name: "message_delta with open block", events: []Event{start, contentBlockStartEvent(0, textBlock), messageDeltaEvent(core.STOP_END_TURN, nil)}},
+		{name: "message_stop without message_delta", events: []Event{start, messageStopEvent()}},
+		{name: "event after error", events: []Event{start, ErrorEvent(ERROR_TYPE_API, "failed"), pingEvent()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := NewValidator(SinkFunc(func(Event) error { return nil }))
+			var err error
+			for _, event := range tt.events {
+				if err = validator.Send(event); err != nil {
+					break
+				}
+			}
+			var grammarErr *GrammarError
+			if !errors.As(err, &grammarErr) {
+				t.Fatalf("got %v, want a GrammarError", err)
+			}
+			if grammarErr.Position != len(tt.events)-1 {
+				t.Errorf("error at position %d, want %d: %v", grammarErr.Position, len(tt.events)-1, err)
+			}
+		})
+	}
+}
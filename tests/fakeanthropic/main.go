@@ -0,0 +1,118 @@
+// Command fakeanthropic is a local stand-in for the Anthropic API. It serves /v1/messages, streaming
+// and not, and /v1/messages/count_tokens with x-api-key authentication. Replies echo the received
+// model and anthropic-beta header; streams include a server_tool_use block, which only survives
+// an unchanged passthrough. Models starting with "overloaded" fail with an overloaded_error event:
+//
+//	go run ./tests/fakeanthropic -addr :8887 -key test-key
+//
+// with a provider {"name": "anthropic", "type": "anthropic", "base_url": "http://localhost:8887", "api_key": "test-key"}.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+var apiKey = flag.String("key", "test-key", "expected x-api-key header")
+
+func writeError(w http.ResponseWriter, status int, errType, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"type": "error", "error": map[string]string{"type": errType, "message": message}})
+}
+
+// authorize checks the headers every Anthropic request needs.
+func authorize(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("x-api-key") != *apiKey {
+		writeError(w, http.StatusUnauthorized, "authentication_error", "invalid x-api-key")
+		return false
+	}
+	if r.Header.Get("anthropic-version") == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "anthropic-version: header is required")
+		return false
+	}
+	return true
+}
+
+func handleMessages(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r) {
+		return
+	}
+	var req struct {
+		Model  string `json:"model"`
+		Stream bool   `json:"stream"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	beta := r.Header.Get("anthropic-beta")
+	log.Printf("model=%s stream=%v anthropic-version=%s anthropic-beta=%s", req.Model, req.Stream, r.Header.Get("anthropic-version"), beta)
+	text := fmt.Sprintf("Hello from Anthropic model %s (beta: %s)", req.Model, beta)
+
+	if !req.Stream {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"id": "msg_fake", "type": "message", "role": "assistant", "model": req.Model,
+			"content":     []any{map[string]any{"type": "text", "text": text}},
+			"stop_reason": "end_turn", "stop_sequence": nil,
+			"usage": map[string]any{"input_tokens": 15, "output_tokens": 9, "cache_read_input_tokens": 0,
+				"server_tool_use": map[string]int{"web_search_requests": 0}},
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	flusher, _ := w.(http.Flusher)
+	send := func(data string) {
+		var event struct {
+			Type string `json:"type"`
+		}
+		json.Unmarshal([]byte(data), &event)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	if strings.HasPrefix(req.Model, "overloaded") {
+		send(`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`)
+		return
+	}
+	encodedText, _ := json.Marshal(text)
+	send(`{"type":"message_start","message":{"id":"msg_fake","type":"message","role":"assistant","model":"` + req.Model + `","content":[],"stop_reason":null,"stop_sequence":null,"usage":{"input_tokens":15,"output_tokens":1,"server_tool_use":{"web_search_requests":1}}}}`)
+	send(`{"type":"ping"}`)
+	send(`{"type":"content_block_start","index":0,"content_block":{"type":"server_tool_use","id":"srvtoolu_1","name":"web_search","input":{}}}`)
+	send(`{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"{\"query\":\"weather\"}"}}`)
+	send(`{"type":"content_block_stop","index":0}`)
+	send(`{"type":"content_block_start","index":1,"content_block":{"type":"text","text":""}}`)
+	send(`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":` + string(encodedText) + `}}`)
+	send(`{"type":"content_block_stop","index":1}`)
+	send(`{"type":"message_delta","delta":{"stop_reason":"end_turn","stop_sequence":null},"usage":{"output_tokens":9}}`)
+	send(`{"type":"message_stop"}`)
+}
+
+func handleCountTokens(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r) {
+		return
+	}
+	var req struct {
+		Model string `json:"model"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	log.Printf("count_tokens model=%s", req.Model)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"input_tokens": 42})
+}
+
+func main() {
+	addr := flag.String("addr", ":8887", "listen address")
+	flag.Parse()
+	http.HandleFunc("/v1/messages", handleMessages)
+	http.HandleFunc("/v1/messages/count_tokens", handleCountTokens)
+	log.Printf("Fake Anthropic listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
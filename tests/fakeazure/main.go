@@ -0,0 +1,104 @@
+// Command fakeazure is a local stand-in for an Azure OpenAI resource. It mimics Azure's URL layout
+// ({base}/openai/deployments/{deployment}/chat/completions?api-version=...) and api-key authentication,
+// so the proxy can be exercised in Azure mode without a real deployment:
+//
+//	go run ./tests/fakeazure -addr :8883 -key test-key
+//	OPENAI_BASE_URL=http://localhost:8883 OPENAI_API_KEY=test-key AZURE_API_VERSION=2024-06-01 go run .
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var apiKey = flag.String("key", "test-key", "expected api-key header")
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"error": map[string]string{"code": code, "message": message}})
+}
+
+func handleDeployment(w http.ResponseWriter, r *http.Request) {
+	// /openai/deployments/{deployment}/chat/completions
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 5 || parts[0] != "openai" || parts[1] != "deployments" || parts[3] != "chat" || parts[4] != "completions" {
+		writeError(w, http.StatusNotFound, "404", "Resource not found")
+		return
+	}
+	deployment := parts[2]
+
+	if r.URL.Query().Get("api-version") == "" {
+		writeError(w, http.StatusNotFound, "404", "Resource not found")
+		return
+	}
+	if r.Header.Get("api-key") != *apiKey {
+		writeError(w, http.StatusUnauthorized, "401", "Access denied due to invalid subscription key or wrong API endpoint.")
+		return
+	}
+
+	var req struct {
+		Stream bool `json:"stream"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+	log.Printf("deployment=%s api-version=%s stream=%v", deployment, r.URL.Query().Get("api-version"), req.Stream)
+
+	id := fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano())
+	text := "Hello from Azure deployment " + deployment
+	if !req.Stream {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"id":     id,
+			"object": "chat.completion",
+			"model":  deployment,
+			"choices": []map[string]any{{
+				"index":         0,
+				"message":       map[string]string{"role": "assistant", "content": text},
+				"finish_reason": "stop",
+			}},
+			"usage": map[string]int{"prompt_tokens": 10, "completion_tokens": 7, "total_tokens": 17},
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	flusher, _ := w.(http.Flusher)
+	send := func(chunk map[string]any) {
+		data, _ := json.Marshal(chunk)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	for _, word := range strings.SplitAfter(text, " ") {
+		send(map[string]any{
+			"id": id, "object": "chat.completion.chunk", "model": deployment,
+			"choices": []map[string]any{{"index": 0, "delta": map[string]string{"content": word}}},
+		})
+	}
+	send(map[string]any{
+		"id": id, "object": "chat.completion.chunk", "model": deployment,
+		"choices": []map[string]any{{"index": 0, "delta": map[string]any{}, "finish_reason": "stop"}},
+	})
+	send(map[string]any{
+		"id": id, "object": "chat.completion.chunk", "model": deployment, "choices": []any{},
+		"usage": map[string]int{"prompt_tokens": 10, "completion_tokens": 7, "total_tokens": 17},
+	})
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func main() {
+	addr := flag.String("addr", ":8883", "listen address")
+	flag.Parse()
+	http.HandleFunc("/openai/deployments/", handleDeployment)
+	log.Printf("Fake Azure OpenAI listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
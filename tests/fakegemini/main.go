@@ -0,0 +1,101 @@
+// Command fakegemini is a local stand-in for the Gemini API. It serves generateContent and
+// streamGenerateContent?alt=sse under {base}/models/{model} with x-goog-api-key authentication.
+// Replies carry a thought, a thought signature and, when the request declares tools, a function
+// call of the first tool, so the proxy's Gemini backend can be exercised without a real key:
+//
+//	go run ./tests/fakegemini -addr :8885 -key test-key
+//
+// with a provider {"name": "gemini", "type": "gemini", "base_url": "http://localhost:8885/v1beta", "api_key": "test-key"}.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+var apiKey = flag.String("key", "test-key", "expected x-goog-api-key header")
+
+func writeError(w http.ResponseWriter, status int, statusName, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"error": map[string]any{"code": status, "message": message, "status": statusName}})
+}
+
+func handleModel(w http.ResponseWriter, r *http.Request) {
+	// /v1beta/models/{model}:{method}
+	model, method, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1beta/models/"), ":")
+	if !ok || (method != "generateContent" && method != "streamGenerateContent") {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Method not found.")
+		return
+	}
+	if r.Header.Get("x-goog-api-key") != *apiKey {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "API key not valid. Please pass a valid API key.")
+		return
+	}
+
+	var req struct {
+		Tools []struct {
+			FunctionDeclarations []struct {
+				Name string `json:"name"`
+			} `json:"functionDeclarations"`
+		} `json:"tools"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return
+	}
+	log.Printf("model=%s method=%s tools=%d", model, method, len(req.Tools))
+
+	parts := []map[string]any{
+		{"text": "Considering the question.", "thought": true},
+		{"text": "Hello from Gemini model " + model, "thoughtSignature": "c2lnbmF0dXJl"},
+	}
+	if len(req.Tools) > 0 && len(req.Tools[0].FunctionDeclarations) > 0 {
+		parts = append(parts, map[string]any{"functionCall": map[string]any{
+			"name": req.Tools[0].FunctionDeclarations[0].Name,
+			"args": map[string]any{"location": "Paris"},
+		}})
+	}
+	usage := map[string]int{"promptTokenCount": 12, "candidatesTokenCount": 8, "thoughtsTokenCount": 4}
+
+	if method == "generateContent" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"candidates":    []map[string]any{{"content": map[string]any{"role": "model", "parts": parts}, "finishReason": "STOP"}},
+			"usageMetadata": usage,
+		})
+		return
+	}
+
+	if r.URL.Query().Get("alt") != "sse" {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "only alt=sse is supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	flusher, _ := w.(http.Flusher)
+	for i, part := range parts {
+		candidate := map[string]any{"content": map[string]any{"role": "model", "parts": []any{part}}}
+		chunk := map[string]any{"candidates": []any{candidate}}
+		if i == len(parts)-1 {
+			candidate["finishReason"] = "STOP"
+			chunk["usageMetadata"] = usage
+		}
+		data, _ := json.Marshal(chunk)
+		fmt.Fprintf(w, "data: %s\r\n\r\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+func main() {
+	addr := flag.String("addr", ":8885", "listen address")
+	flag.Parse()
+	http.HandleFunc("/v1beta/models/", handleModel)
+	log.Printf("Fake Gemini listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
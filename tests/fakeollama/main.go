@@ -0,0 +1,121 @@
+// Command fakeollama is a local stand-in for an Ollama server. It serves /api/tags and /api/chat
+// with NDJSON streaming. Replies carry thinking when the request sets think, and a tool call of
+// the first tool when the request declares tools:
+//
+//	go run ./tests/fakeollama -addr :8886
+//
+// with a provider {"name": "ollama", "type": "ollama", "base_url": "http://localhost:8886"}.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var installed = []string{"qwen3:8b", "llama3.1:8b"}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+func handleTags(w http.ResponseWriter, r *http.Request) {
+	modelList := []map[string]any{}
+	for _, name := range installed {
+		modelList = append(modelList, map[string]any{
+			"name": name, "model": name, "modified_at": "2025-06-01T10:00:00.000000000Z", "size": 5000000000,
+			"details": map[string]string{"family": strings.Split(name, ":")[0], "parameter_size": "8B", "quantization_level": "Q4_K_M"},
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"models": modelList})
+}
+
+func handleChat(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Model     string         `json:"model"`
+		Stream    *bool          `json:"stream"`
+		Think     any            `json:"think"`
+		Options   map[string]any `json:"options"`
+		KeepAlive string         `json:"keep_alive"`
+		Tools     []struct {
+			Function struct {
+				Name string `json:"name"`
+			} `json:"function"`
+		} `json:"tools"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	found := false
+	for _, name := range installed {
+		found = found || name == req.Model
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "model '"+req.Model+"' not found")
+		return
+	}
+	// Ollama streams unless told otherwise
+	stream := req.Stream == nil || *req.Stream
+	log.Printf("model=%s stream=%v think=%v options=%v keep_alive=%q", req.Model, stream, req.Think, req.Options, req.KeepAlive)
+
+	thinking := ""
+	if req.Think != nil && req.Think != false {
+		thinking = "The user greets me."
+	}
+	content := "Hello from Ollama model " + req.Model
+	var toolCalls []any
+	if len(req.Tools) > 0 {
+		toolCalls = []any{map[string]any{"function": map[string]any{
+			"name": req.Tools[0].Function.Name, "arguments": map[string]any{"location": "Berlin"},
+		}}}
+	}
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	done := map[string]any{
+		"model": req.Model, "created_at": now, "message": map[string]any{"role": "assistant", "content": ""},
+		"done": true, "done_reason": "stop", "prompt_eval_count": 26, "eval_count": 9,
+	}
+
+	if !stream {
+		done["message"] = map[string]any{"role": "assistant", "content": content, "thinking": thinking, "tool_calls": toolCalls}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(done)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	send := func(message map[string]any) {
+		message["role"] = "assistant"
+		encoder.Encode(map[string]any{"model": req.Model, "created_at": now, "message": message, "done": false})
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	if thinking != "" {
+		send(map[string]any{"content": "", "thinking": thinking})
+	}
+	for _, word := range strings.SplitAfter(content, " ") {
+		send(map[string]any{"content": word})
+	}
+	if toolCalls != nil {
+		send(map[string]any{"content": "", "tool_calls": toolCalls})
+	}
+	encoder.Encode(done)
+}
+
+func main() {
+	addr := flag.String("addr", ":8886", "listen address")
+	flag.Parse()
+	http.HandleFunc("/api/tags", handleTags)
+	http.HandleFunc("/api/chat", handleChat)
+	log.Printf("Fake Ollama listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
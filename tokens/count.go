@@ -0,0 +1,250 @@
+package tokens
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/jiaobendaye/go-claude-code-proxy/core"
+	"github.com/jiaobendaye/go-claude-code-proxy/models"
+	"github.com/tiktoken-go/tokenizer"
+	_ "golang.org/x/image/webp"
+)
+
+// Chat format overheads of OpenAI models: every message is wrapped in
+// <|start|>{role}<|message|>{content}<|end|> and the reply is primed with <|start|>assistant<|message|>.
+const (
+	tokensPerMessage  = 3
+	tokensReplyPrimer = 3
+	tokensPerToolCall = 3
+)
+
+// Overheads of the function definitions rendered into the prompt.
+type toolOverheads struct {
+	funcInit, propInit, propKey, enumInit, enumItem, funcEnd int
+}
+
+func toolOverheadsForModel(model string) toolOverheads {
+	if EncodingForModel(model) == tokenizer.O200kBase {
+		return toolOverheads{funcInit: 7, propInit: 3, propKey: 3, enumInit: -3, enumItem: 3, funcEnd: 12}
+	}
+	return toolOverheads{funcInit: 10, propInit: 3, propKey: 3, enumInit: -3, enumItem: 3, funcEnd: 12}
+}
+
+// Counter counts prompt tokens for one upstream model.
+type Counter struct {
+	model        string
+	providerType string
+	codec        tokenizer.Codec
+}
+
+// NewCounter returns the counter of the upstream model a route sends to. Images are counted by
+// the pricing of the provider's API.
+func NewCounter(route core.Route) *Counter {
+	providerType := core.PROVIDER_OPENAI
+	if route.Provider != nil {
+		providerType = route.Provider.Type
+	}
+	return &Counter{model: route.Model, providerType: providerType, codec: CodecForModel(route.Model)}
+}
+
+// Text returns the number of tokens of a plain string.
+func (c *Counter) Text(text string) int {
+	if text == "" {
+		return 0
+	}
+	ids, _, err := c.codec.Encode(text)
+	if err != nil {
+		// Fall back to the usual 4 characters per token estimate
+		return (len(text) + 3) / 4
+	}
+	return len(ids)
+}
+
+// CountInput counts the prompt tokens the upstream model bills for a Claude request once it
+// has been converted: system prompt, messages, thinking, tool definitions, tool calls and images.
+func (c *Counter) CountInput(system models.ClaudeContent, messages []models.ClaudeMessage, tools []models.ClaudeTool) int {
+	total := tokensReplyPrimer
+	if systemText := strings.TrimSpace(core.JoinText(system, "\n\n")); systemText != "" {
+		total += tokensPerMessage + c.Text(core.ROLE_SYSTEM) + c.Text(systemText)
+	}
+	for _, msg := range messages {
+		total += c.message(msg)
+	}
+	total += c.Tools(tools)
+	return total
+}
+
+func (c *Counter) message(msg models.ClaudeMessage) int {
+	total := tokensPerMessage + c.Text(msg.Role)
+	for _, block := range msg.Content {
+		switch block := block.(type) {
+		case models.ClaudeContentBlockText:
+			total += c.Text(block.Text)
+		case models.ClaudeContentBlockImage:
+			total += c.Image(block.Source)
+		case models.ClaudeContentBlockDocument:
+			total += c.Text(block.Title) + c.Text(block.Context)
+			if block.Source.Type == core.SOURCE_TEXT {
+				total += c.Text(block.Source.Data)
+			}
+			total += c.Text(core.JoinText(block.Source.Content, "\n"))
+		case models.ClaudeContentBlockThinking:
+			total += c.Text(block.Thinking)
+		case models.ClaudeContentBlockRedactedThinking:
+			// The data stands for reasoning the upstream is sent back, of about its size
+			total += c.Text(block.Data)
+		case models.ClaudeContentBlockToolUse:
+			arguments, _ := json.Marshal(block.Input)
+			total += tokensPerToolCall + c.Text(block.Name) + c.Text(string(arguments))
+		case models.ClaudeContentBlockToolResult:
+			// Every tool result becomes its own tool message
+			total += tokensPerMessage + c.Text(core.ROLE_TOOL) + c.Text(block.ToolUseID)
+			for _, item := range block.Content {
+				switch item := item.(type) {
+				case models.ClaudeContentBlockText:
+					total += c.Text(item.Text)
+				case models.ClaudeContentBlockImage:
+					total += c.Image(item.Source)
+				default:
+					serialized, _ := json.Marshal(item)
+					total += c.Text(string(serialized))
+				}
+			}
+		case models.ClaudeContentBlockUnknown:
+			total += c.Text(string(block.Raw))
+		}
+	}
+	return total
+}
+
+// Tools counts function definitions the way OpenAI renders them into the prompt.
+func (c *Counter) Tools(tools []models.ClaudeTool) int {
+	if len(tools) == 0 {
+		return 0
+	}
+	overheads := toolOverheadsForModel(c.model)
+	total := 0
+	for _, tool := range tools {
+		total += overheads.funcInit
+		total += c.Text(tool.Name + ":" + strings.TrimSuffix(tool.Description, "."))
+		total += c.properties(tool.InputSchema, overheads)
+	}
+	return total + overheads.funcEnd
+}
+
+func (c *Counter) properties(schema map[string]any, overheads toolOverheads) int {
+	properties, ok := schema["properties"].(map[string]any)
+	if !ok || len(properties) == 0 {
+		return 0
+	}
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	total := overheads.propInit
+	for _, name := range names {
+		property, _ := properties[name].(map[string]any)
+		total += overheads.propKey
+		propertyType, _ := property["type"].(string)
+		description, _ := property["description"].(string)
+		if enum, ok := property["enum"].([]any); ok {
+			total += overheads.enumInit
+			for _, item := range enum {
+				total += overheads.enumItem + c.Text(fmt.Sprint(item))
+			}
+		}
+		total += c.Text(name + ":" + propertyType + ":" + strings.TrimSuffix(description, "."))
+		// Nested objects and arrays of objects are rendered inline as well
+		total += c.properties(property, overheads)
+		if items, ok := property["items"].(map[string]any); ok {
+			total += c.properties(items, overheads)
+		}
+	}
+	return total
+}
+
+// Image returns the token cost of an image block.
+func (c *Counter) Image(source models.ClaudeImageSource) int {
+	width, height := 0, 0
+	if source.Type == core.SOURCE_BASE64 {
+		// Only the image header is decoded
+		reader := base64.NewDecoder(base64.StdEncoding, strings.NewReader(source.Data))
+		if config, _, err := image.DecodeConfig(reader); err == nil {
+			width, height = config.Width, config.Height
+		}
+	}
+	if width == 0 || height == 0 {
+		// Dimensions unknown (URL, file or undecodable image): assume a typical 1024x1024 screenshot
+		width, height = 1024, 1024
+	}
+	return ImageTokens(c.providerType, c.model, width, height)
+}
+
+// ImageTokens returns the tokens an image of a size costs on an upstream of a provider type.
+// Ollama models bill nothing and count images by their own vision encoder, their images are
+// counted like OpenAI's as an approximation.
+func ImageTokens(providerType, model string, width, height int) int {
+	switch providerType {
+	case core.PROVIDER_ANTHROPIC:
+		return anthropicImageTokens(width, height)
+	case core.PROVIDER_GEMINI:
+		return geminiImageTokens(width, height)
+	}
+	return openaiImageTokens(model, width, height)
+}
+
+// anthropicImageTokens applies Anthropic's image pricing: the image is scaled down to a 1568px
+// longest edge and about 1.15 megapixels, then billed a token per 750 pixels.
+func anthropicImageTokens(width, height int) int {
+	w, h := float64(width), float64(height)
+	if math.Max(w, h) > 1568 {
+		scale := 1568 / math.Max(w, h)
+		w, h = w*scale, h*scale
+	}
+	if w*h > 1_150_000 {
+		scale := math.Sqrt(1_150_000 / (w * h))
+		w, h = w*scale, h*scale
+	}
+	return int(math.Ceil(w * h / 750))
+}
+
+// geminiImageTokens applies Gemini's image pricing: images up to 384px on both sides cost 258
+// tokens, larger ones 258 tokens per 768px tile.
+func geminiImageTokens(width, height int) int {
+	if width <= 384 && height <= 384 {
+		return 258
+	}
+	tiles := int(math.Ceil(float64(width)/768) * math.Ceil(float64(height)/768))
+	return 258 * tiles
+}
+
+// openaiImageTokens applies OpenAI's high detail image pricing: the image is fit into 2048x2048,
+// its shortest side scaled down to 768px, and billed per 512px tile on top of a base cost.
+func openaiImageTokens(model string, width, height int) int {
+	baseTokens, tileTokens := 85, 170
+	if strings.Contains(strings.ToLower(model), "4o-mini") {
+		baseTokens, tileTokens = 2833, 5667
+	}
+
+	w, h := float64(width), float64(height)
+	if w > 2048 || h > 2048 {
+		scale := 2048 / math.Max(w, h)
+		w, h = w*scale, h*scale
+	}
+	if math.Min(w, h) > 768 {
+		scale := 768 / math.Min(w, h)
+		w, h = w*scale, h*scale
+	}
+	tiles := int(math.Ceil(w/512) * math.Ceil(h/512))
+	return baseTokens + tileTokens*tiles
+}
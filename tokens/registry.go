@@ -0,0 +1,51 @@
+package tokens
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/tiktoken-go/tokenizer"
+)
+
+// The vocabularies are embedded in the binary by the tokenizer package, no download is needed.
+var (
+	codecs   = map[tokenizer.Encoding]tokenizer.Codec{}
+	codecsMu sync.Mutex
+)
+
+// o200kPrefixes lists the model families tokenized with o200k_base, everything else uses cl100k_base.
+var o200kPrefixes = []string{"gpt-4o", "chatgpt-4o", "gpt-4.1", "gpt-4.5", "gpt-5", "o1", "o3", "o4", "gpt-oss"}
+
+// EncodingForModel returns the BPE vocabulary used by an upstream model. Non-OpenAI models use
+// their own tokenizers, cl100k_base is the closest general purpose approximation for them.
+func EncodingForModel(model string) tokenizer.Encoding {
+	model = strings.ToLower(model)
+	// Strip vendor prefixes like "openai/gpt-4o"
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		model = model[i+1:]
+	}
+	for _, prefix := range o200kPrefixes {
+		if strings.HasPrefix(model, prefix) {
+			return tokenizer.O200kBase
+		}
+	}
+	return tokenizer.Cl100kBase
+}
+
+// CodecForModel returns the tokenizer of an upstream model. Codecs are built once and shared.
+func CodecForModel(model string) tokenizer.Codec {
+	encoding := EncodingForModel(model)
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	if codec, ok := codecs[encoding]; ok {
+		return codec
+	}
+	codec, err := tokenizer.Get(encoding)
+	if err != nil {
+		// Both encodings are built in, this only happens if the tokenizer package drops one
+		log.Fatalf("Failed to load tokenizer %s: %v", encoding, err)
+	}
+	codecs[encoding] = codec
+	return codec
+}